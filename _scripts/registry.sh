@@ -6,6 +6,8 @@ basic_auth_file="$git_root/.dev/auth/htpasswd"
 registry_name="test_registry"
 registry_port=5000
 cmd="docker"
+# azula binary used to fill the registry, e.g. AZULA_BIN=azula for an installed one
+azula=${AZULA_BIN:-"go run $git_root/cmd/azula"}
 
 mkdir -p $registry_files
 
@@ -37,6 +39,7 @@ fi
 
 up_registry() {
 gen_basic_auth
+# registry:2 rejects deletes with UNSUPPORTED unless REGISTRY_STORAGE_DELETE_ENABLED is set
 docker run -d \
   -p $registry_port:5000 \
   --restart=always \
@@ -55,21 +58,24 @@ down(){
   $cmd rm $registry_name
 }
 
+# fill exports the image from docker hub once and imports it under every name,
+# so neither a docker daemon nor docker login is needed
 fill(){
-  local src_img=hello-world:latest
+  local src_img=library/hello-world:latest
   if [[ $fill_max < 1 ]]; then
     fill_max=1
   fi
   if [[ -z $img_name ]]; then
     img_name=test
   fi
-  $cmd pull $src_img
+  local archive=$(mktemp -d)/hello-world.tar tags=()
+  $azula --registry https://registry-1.docker.io img export $src_img --platform linux/amd64 -o $archive || return 1
   for ((i=1; i<=$fill_max; i++)); do
-    dst_img=127.0.0.1:$registry_port/$img_name-$i:v0.1
-    $cmd tag $src_img $dst_img
-    $cmd push $dst_img
-    $cmd rmi $dst_img
+    tags+=(--tag $img_name-$i:v0.1)
   done
+  AZULA_USERNAME=testuser AZULA_PASSWORD=testpassword \
+    $azula --registry http://127.0.0.1:$registry_port img import $archive "${tags[@]}"
+  rm -r $(dirname $archive)
 }
 
 case $1 in
@@ -1,49 +1,136 @@
 package main
 
 import (
+	"fmt"
 	"net/url"
 	"os"
 
+	"github.com/nikgalkin/azula/pkg/azula/config"
 	"github.com/nikgalkin/azula/pkg/azula/delivery/cli"
 	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
 	"github.com/nikgalkin/azula/pkg/azula/repository/docker/auth"
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker/registry"
 	"github.com/nikgalkin/azula/pkg/azula/usecase"
 )
 
 func main() {
-	mgr, err := genRegistryInit()
+	cli.New(newUsecase, newAuth, newSync).Execute()
+}
+
+func newUsecase(c config.Context) (usecase.ManUsecase, error) {
+	mgr, err := genRegistryInit(c)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	dr, err := mgr.New()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	cli.New(usecase.New(dr)).Execute()
+	return usecase.New(dr, usecase.Options{Concurrency: c.Concurrency}), nil
 }
 
-func genRegistryInit() (*docker.RegistryInit, error) {
-	cfg, err := auth.LoadDefaultConfig()
-	if err != nil {
-		return &docker.RegistryInit{}, err
+func newAuth(c config.Context) (usecase.AuthUsecase, error) {
+	return usecase.NewAuth(baseRegistryInit(c), func() (docker.RegistryInit, error) {
+		init, err := genRegistryInit(c)
+		return *init, err
+	}), nil
+}
+
+func newSync(from, to config.Context) (usecase.SyncUsecase, error) {
+	managers := make([]docker.Manager, 0, 2)
+	for _, c := range []config.Context{from, to} {
+		init, err := genRegistryInit(c)
+		if err != nil {
+			return nil, err
+		}
+		dr, err := init.New()
+		if err != nil {
+			return nil, err
+		}
+		managers = append(managers, dr)
+	}
+	return usecase.NewSync(managers[0], managers[1],
+		usecase.Options{Concurrency: from.Concurrency},
+		usecase.Options{Concurrency: to.Concurrency},
+	), nil
+}
+
+// baseRegistryInit returns the registry settings of the context without credentials.
+func baseRegistryInit(c config.Context) docker.RegistryInit {
+	return docker.RegistryInit{
+		URL: c.URL,
+		TLS: registry.TLSOptions{
+			CAFile:             c.TLS.CAFile,
+			CADir:              c.TLS.CADir,
+			CertFile:           c.TLS.CertFile,
+			KeyFile:            c.TLS.KeyFile,
+			CertsDir:           c.TLS.CertsDir,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		},
+		Retry: registry.RetryOptions{
+			Attempts:   c.Retry.Attempts,
+			MinBackoff: c.Retry.MinBackoff,
+			MaxBackoff: c.Retry.MaxBackoff,
+		},
+		Timeout:   c.Timeout,
+		RateLimit: c.RateLimit,
 	}
+}
 
-	registry := os.Getenv("AZULA_REGISTRY")
-	if len(registry) < 1 {
-		registry = "http://127.0.0.1:5000"
+func genRegistryInit(c config.Context) (*docker.RegistryInit, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return &docker.RegistryInit{}, err
 	}
 
-	u, err := url.Parse(registry)
+	chain, err := credentialChain(c)
 	if err != nil {
 		return &docker.RegistryInit{}, err
 	}
-	user, pass, err := cfg.GetRegistryCredentials(u.Host)
+	user, pass, source, err := chain.Get(u.Host)
 	if err != nil {
 		return &docker.RegistryInit{}, err
 	}
-	return &docker.RegistryInit{
-		Username: user,
-		Password: pass,
-		URL:      registry,
-	}, nil
+
+	init := baseRegistryInit(c)
+	init.CredentialSource = source
+	// an empty username means the password is an identity token
+	if len(user) < 1 {
+		init.IdentityToken = pass
+	} else {
+		init.Username, init.Password = user, pass
+	}
+	if c.PersistRefreshToken && source == auth.SourceDocker {
+		init.OnRefreshToken = func(token string) {
+			cfg, err := auth.LoadDefaultConfigIfExists()
+			if err == nil {
+				err = cfg.SetIdentityToken(u.Host, token)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "WARN: can't persist refresh token:", err)
+			}
+		}
+	}
+	return &init, nil
+}
+
+func credentialChain(c config.Context) (auth.Chain, error) {
+	chain := auth.Chain{}
+	for _, name := range c.CredentialChain() {
+		switch name {
+		case config.CredentialsEnv:
+			chain = append(chain, auth.EnvSource{})
+		case config.CredentialsPasswordFile:
+			chain = append(chain, auth.PasswordFileSource{Username: c.Username, Path: c.PasswordFile})
+		case config.CredentialsDockerConfigJSON:
+			chain = append(chain, auth.DockerConfigJSONSource{Path: c.DockerConfigJSON})
+		case config.CredentialsDocker:
+			chain = append(chain, auth.DockerSource{})
+		case config.CredentialsAnonymous:
+			chain = append(chain, auth.AnonymousSource{})
+		default:
+			return nil, fmt.Errorf("unknown credentials source '%s' of context '%s'", name, c.Name)
+		}
+	}
+	return chain, nil
 }
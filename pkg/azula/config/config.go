@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Credential sources, see Context.Credentials.
+const (
+	CredentialsEnv              = "env"
+	CredentialsPasswordFile     = "password-file"
+	CredentialsDockerConfigJSON = "dockerconfigjson"
+	CredentialsDocker           = "docker"
+	CredentialsAnonymous        = "anonymous"
+)
+
+// DefaultCredentials is the chain of credential sources used if a context doesn't set one.
+var DefaultCredentials = []string{
+	CredentialsEnv, CredentialsPasswordFile, CredentialsDockerConfigJSON, CredentialsDocker, CredentialsAnonymous,
+}
+
+// Config represents the on disk format of the azula config file.
+type Config struct {
+	CurrentContext string    `yaml:"current-context,omitempty"`
+	Contexts       []Context `yaml:"contexts,omitempty"`
+
+	path string
+}
+
+// Context is a named registry with settings to access it.
+type Context struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Credentials is a comma separated chain of credential sources, the first source
+	// having credentials of the registry wins. DefaultCredentials is used if empty.
+	Credentials string `yaml:"credentials,omitempty"`
+	// Username and PasswordFile are used by the password-file source.
+	Username     string `yaml:"username,omitempty"`
+	PasswordFile string `yaml:"password-file,omitempty"`
+	// DockerConfigJSON is a path to a mounted dockerconfigjson secret used by the dockerconfigjson source.
+	DockerConfigJSON string `yaml:"docker-config-json,omitempty"`
+	// PersistRefreshToken saves refresh tokens issued by a token server as the identity
+	// token of the docker config, otherwise they are kept for the session only.
+	PersistRefreshToken bool `yaml:"persist-refresh-token,omitempty"`
+	// Protected registries require typing the registry host to confirm deletion.
+	Protected bool  `yaml:"protected,omitempty"`
+	TLS       TLS   `yaml:"tls,omitempty"`
+	Retry     Retry `yaml:"retry,omitempty"`
+	// Timeout limits waiting for a response of a single request attempt, e.g. 30s.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Concurrency limits registry calls made at once.
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// RateLimit is the max number of requests per second to the registry.
+	RateLimit float64  `yaml:"rate-limit,omitempty"`
+	Defaults  Defaults `yaml:"defaults,omitempty"`
+}
+
+// CredentialChain returns names of the credential sources of the context in order.
+func (c Context) CredentialChain() []string {
+	if strings.TrimSpace(c.Credentials) == "" {
+		return DefaultCredentials
+	}
+	chain := []string{}
+	for _, v := range strings.Split(c.Credentials, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			chain = append(chain, v)
+		}
+	}
+	return chain
+}
+
+type TLS struct {
+	CAFile   string `yaml:"ca-file,omitempty"`
+	CADir    string `yaml:"ca-dir,omitempty"`
+	CertFile string `yaml:"cert-file,omitempty"`
+	KeyFile  string `yaml:"key-file,omitempty"`
+	// CertsDir is a dir in the docker certs.d layout, /etc/docker/certs.d by default.
+	CertsDir           string `yaml:"certs-dir,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify,omitempty"`
+}
+
+// Retry configures retries of transient registry failures, zero values mean defaults.
+type Retry struct {
+	Attempts   int           `yaml:"attempts,omitempty"`
+	MinBackoff time.Duration `yaml:"min-backoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"max-backoff,omitempty"`
+}
+
+// Defaults are used for the flags which are not set explicitly.
+type Defaults struct {
+	Like    string `yaml:"like,omitempty"`
+	Entries int    `yaml:"entries,omitempty"`
+}
+
+// Path returns the path to the config file.
+//
+// It will either use the AZULA_CONFIG env var if set, or config.yaml in the azula
+// dir of XDG_CONFIG_HOME, which is ~/.config by default.
+func Path() (string, error) {
+	if p := os.Getenv("AZULA_CONFIG"); p != "" {
+		return p, nil
+	}
+	if p := os.Getenv("XDG_CONFIG_HOME"); p != "" {
+		return filepath.Join(p, "azula", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error looking up user home dir: %w", err)
+	}
+	return filepath.Join(home, ".config", "azula", "config.yaml"), nil
+}
+
+// Load loads the config from the path returned from `Path`, a missing file is an empty config.
+func Load() (*Config, error) {
+	p, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{path: p}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("can't parse %s: %w", p, err)
+	}
+	return cfg, nil
+}
+
+// Save writes the config to the file it was loaded from.
+func (c *Config) Save() error {
+	buf := bytes.Buffer{}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, buf.Bytes(), 0o600)
+}
+
+func (c *Config) Get(name string) (Context, bool) {
+	for _, v := range c.Contexts {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Context{}, false
+}
+
+// Add adds a new context, names must be unique.
+func (c *Config) Add(ctx Context) error {
+	if len(ctx.Name) < 1 || len(ctx.URL) < 1 {
+		return errors.New("context name and url are required")
+	}
+	if _, ok := c.Get(ctx.Name); ok {
+		return fmt.Errorf("context '%s' already exists", ctx.Name)
+	}
+	c.Contexts = append(c.Contexts, ctx)
+	return nil
+}
+
+// Remove removes the context and unsets it as the current one.
+func (c *Config) Remove(name string) error {
+	for i, v := range c.Contexts {
+		if v.Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.CurrentContext == name {
+				c.CurrentContext = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("context '%s' not found", name)
+}
+
+func (c *Config) Use(name string) error {
+	if _, ok := c.Get(name); !ok {
+		return fmt.Errorf("context '%s' not found", name)
+	}
+	c.CurrentContext = name
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	authCmd = &cobra.Command{
+		Use:         "auth",
+		Short:       "Inspect registry credentials",
+		Annotations: map[string]string{annotationNoRegistry: ""},
+		Run:         Images,
+	}
+	authWhoamiCmd = &cobra.Command{
+		Use:   "whoami [registry]",
+		Short: "Show credentials used to access the registry and their source",
+		Long: `Resolve credentials like other commands do and check them against the registry.
+Sources are tried in the order of the credentials of the context, by default:
+  env               AZULA_USERNAME and AZULA_PASSWORD
+  password-file     username and password-file of the context, AZULA_USERNAME and AZULA_PASSWORD_FILE
+  dockerconfigjson  docker-config-json of the context or AZULA_DOCKERCONFIGJSON, e.g. a mounted secret
+  docker            docker config and its credential helpers
+  anonymous         no credentials
+  example:
+    azula auth whoami
+    AZULA_PASSWORD_FILE=/run/secrets/registry azula auth whoami --context prod`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  AuthWhoami,
+	}
+	whoamiOutput = ""
+)
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authWhoamiCmd)
+	authWhoamiCmd.Flags().StringVarP(&whoamiOutput, "output", "o", "", "output format: json|yaml (human readable if empty)")
+}
+
+func AuthWhoami(cmd *cobra.Command, args []string) {
+	if len(whoamiOutput) > 0 {
+		checkErr(checkOutputFormat(whoamiOutput, outputJSON, outputYAML))
+	}
+	uc, _ := authUsecase(args)
+	id, verifyErr := uc.WhoAmI(context.Background())
+	switch whoamiOutput {
+	case outputJSON:
+		checkErr(printJSON(os.Stdout, id))
+	case outputYAML:
+		checkErr(printYAML(os.Stdout, id))
+	default:
+		user := id.Username
+		switch {
+		case id.IdentityToken:
+			user = "<identity token>"
+		case id.Anonymous:
+			user = "<anonymous>"
+		case len(user) < 1:
+			// credentials weren't resolved
+			user = "<unknown>"
+		}
+		source := id.Source
+		if len(source) < 1 {
+			source = "none"
+		}
+		tw := newTabWriter(os.Stdout)
+		fmt.Fprintf(tw, "Registry:\t%s\n", id.Registry)
+		fmt.Fprintf(tw, "Source:\t%s\n", source)
+		fmt.Fprintf(tw, "User:\t%s\n", user)
+		checkErr(tw.Flush())
+	}
+	checkErr(verifyErr)
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nikgalkin/azula/pkg/azula/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	contextCmd = &cobra.Command{
+		Use:         "context",
+		Aliases:     []string{"ctx"},
+		Short:       "Manage registry contexts of the config file",
+		Annotations: map[string]string{annotationNoRegistry: ""},
+		Run:         Images,
+	}
+	contextListCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l", "ls"},
+		Short:   "List contexts",
+		Run:     ContextList,
+	}
+	contextUseCmd = &cobra.Command{
+		Use:   "use name",
+		Short: "Set the current context",
+		Args:  cobra.ExactArgs(1),
+		Run:   ContextUse,
+	}
+	contextAddCmd = &cobra.Command{
+		Use:   "add name",
+		Short: "Add a context",
+		Long: `Add a context.
+  example:
+    azula ctx add prod --url https://registry.domain.com --protected --like team-a`,
+		Args: cobra.ExactArgs(1),
+		Run:  ContextAdd,
+	}
+	contextRemoveCmd = &cobra.Command{
+		Use:     "remove name",
+		Aliases: []string{"rm"},
+		Short:   "Remove a context",
+		Args:    cobra.ExactArgs(1),
+		Run:     ContextRemove,
+	}
+	contextNew = config.Context{}
+)
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextListCmd, contextUseCmd, contextAddCmd, contextRemoveCmd)
+	contextAddCmd.Flags().StringVar(&contextNew.URL, "url", "", "registry address")
+	contextAddCmd.Flags().StringVar(&contextNew.Credentials, "credentials", "", "comma separated chain of credential sources: env,password-file,dockerconfigjson,docker,anonymous (all of them if empty)")
+	contextAddCmd.Flags().StringVar(&contextNew.Username, "username", "", "username of the password-file source")
+	contextAddCmd.Flags().StringVar(&contextNew.PasswordFile, "password-file", "", "file with the password of the password-file source")
+	contextAddCmd.Flags().StringVar(&contextNew.DockerConfigJSON, "docker-config-json", "", "dockerconfigjson file of the dockerconfigjson source, e.g. a mounted secret")
+	contextAddCmd.Flags().BoolVar(&contextNew.Protected, "protected", false, "require typing the registry host to confirm deletion")
+	contextAddCmd.Flags().StringVar(&contextNew.TLS.CAFile, "ca-file", "", "PEM encoded CA certificates to trust")
+	contextAddCmd.Flags().StringVar(&contextNew.TLS.CADir, "ca-dir", "", "dir with PEM encoded CA certificates to trust")
+	contextAddCmd.Flags().StringVar(&contextNew.TLS.CertFile, "cert-file", "", "client certificate for mTLS")
+	contextAddCmd.Flags().StringVar(&contextNew.TLS.KeyFile, "key-file", "", "client certificate key for mTLS")
+	contextAddCmd.Flags().StringVar(&contextNew.TLS.CertsDir, "certs-dir", "", "dir in the docker certs.d layout (default /etc/docker/certs.d)")
+	contextAddCmd.Flags().BoolVar(&contextNew.TLS.InsecureSkipVerify, "insecure-skip-tls-verify", false, "don't verify the registry certificate")
+	contextAddCmd.Flags().StringVar(&contextNew.Defaults.Like, "like", "", "default filter of images")
+	contextAddCmd.Flags().IntVar(&contextNew.Defaults.Entries, "entries", 0, "default max entries of repositories")
+	checkErr(contextAddCmd.MarkFlagRequired("url"))
+}
+
+func ContextList(cmd *cobra.Command, args []string) {
+	tw := newTabWriter(os.Stdout)
+	fmt.Fprintln(tw, "CURRENT\tNAME\tURL\tCREDENTIALS\tPROTECTED")
+	for _, v := range meta.Config.Contexts {
+		current := ""
+		if v.Name == meta.Config.CurrentContext {
+			current = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\n", current, v.Name, v.URL, strings.Join(v.CredentialChain(), ","), v.Protected)
+	}
+	checkErr(tw.Flush())
+}
+
+func ContextUse(cmd *cobra.Command, args []string) {
+	checkErr(meta.Config.Use(args[0]))
+	if saveConfig() {
+		fmt.Println("Switched to context", args[0])
+	}
+}
+
+func ContextAdd(cmd *cobra.Command, args []string) {
+	contextNew.Name = args[0]
+	checkErr(meta.Config.Add(contextNew))
+	if saveConfig() {
+		fmt.Println("Added context", args[0])
+	}
+}
+
+func ContextRemove(cmd *cobra.Command, args []string) {
+	checkErr(meta.Config.Remove(args[0]))
+	if saveConfig() {
+		fmt.Println("Removed context", args[0])
+	}
+}
+
+// saveConfig saves the changed config unless it's a dry run, the change is
+// validated by the caller either way.
+func saveConfig() bool {
+	if dryRun {
+		fmt.Println("=> dry run, config not changed")
+		return false
+	}
+	checkErr(meta.Config.Save())
+	return true
+}
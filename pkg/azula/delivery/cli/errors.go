@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/spf13/cobra"
+)
+
+// checkErr is cobra.CheckErr printing a hint for registry errors.
+func checkErr(msg interface{}) {
+	err, ok := msg.(error)
+	if !ok || err == nil {
+		cobra.CheckErr(msg)
+		return
+	}
+	err = docker.FromError(err)
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	if hint := errorHint(err); len(hint) > 0 {
+		fmt.Fprintln(os.Stderr, "Hint:", hint)
+	}
+	os.Exit(1)
+}
+
+// errorHint suggests how to fix registry errors, empty if there is nothing to suggest.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, docker.ErrUnsupported):
+		return "deletes are disabled on the registry; set REGISTRY_STORAGE_DELETE_ENABLED=true (storage.delete.enabled in config.yml) and restart it"
+	case errors.Is(err, docker.ErrTagDeleteUnsupported):
+		return "the registry deletes manifests only; use --force to delete all tags sharing the digest"
+	case errors.Is(err, docker.ErrUnauthorized):
+		return "log in with 'azula login' or check the credentials with 'azula auth whoami'"
+	case errors.Is(err, docker.ErrDenied):
+		return "the account isn't allowed to do it; check the credentials with 'azula auth whoami'"
+	case errors.Is(err, docker.ErrNameUnknown):
+		return "the repository doesn't exist; list repositories with 'azula img ls'"
+	case errors.Is(err, docker.ErrManifestUnknown):
+		return "the tag or digest doesn't exist; list tags with 'azula img ls -o plain'"
+	case errors.Is(err, docker.ErrTooManyRequests):
+		return "the registry throttles requests; lower --concurrency or set --rate-limit"
+	}
+	return ""
+}
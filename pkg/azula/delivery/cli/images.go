@@ -3,6 +3,8 @@ package cli
 import (
 	"os"
 
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
 	"github.com/spf13/cobra"
 )
 
@@ -13,17 +15,49 @@ var (
 		Short:   "Manimulate with images",
 		Run:     Images,
 	}
-	max_entries = 0
-	like        = ""
+	max_entries      = 0
+	like             = ""
+	confirmThreshold = 0
 )
 
 func init() {
 	rootCmd.AddCommand(imagesCmd)
 	imagesCmd.PersistentFlags().IntVarP(&max_entries, "entries", "e", 500, "set max entries of repositories")
 	imagesCmd.PersistentFlags().StringVarP(&like, "like", "l", "", "filter images by string")
+	imagesCmd.PersistentFlags().IntVar(&confirmThreshold, "confirm-threshold", 10, "deleting more tags requires typing the registry host to confirm")
 }
 
 func Images(cmd *cobra.Command, args []string) {
-	cobra.CheckErr(cmd.Usage())
+	checkErr(cmd.Usage())
 	os.Exit(1)
 }
+
+// repositories converts names picked in a survey back to repositories.
+func repositories(names []string) []usecase.Repository {
+	res := make([]usecase.Repository, 0, len(names))
+	for _, v := range names {
+		res = append(res, usecase.Repository{Name: v})
+	}
+	return res
+}
+
+func tagNames(tags []usecase.Tag) []string {
+	res := make([]string, 0, len(tags))
+	for _, v := range tags {
+		res = append(res, v.String())
+	}
+	return res
+}
+
+// pickTags returns tags of the names picked in a survey.
+func pickTags(names []string, tags []usecase.Tag) []usecase.Tag {
+	byName := make(map[string]usecase.Tag, len(tags))
+	for _, v := range tags {
+		byName[v.String()] = v
+	}
+	res := make([]usecase.Tag, 0, len(names))
+	for _, v := range names {
+		res = append(res, byName[v])
+	}
+	return res
+}
@@ -1,40 +1,211 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
+	"github.com/nikgalkin/azula/pkg/azula/config"
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
 	"github.com/spf13/cobra"
 )
 
-var imagesDeleteCmd = &cobra.Command{
-	Use:     "delete",
-	Aliases: []string{"d", "del"},
-	Short:   "Delete images",
-	Run:     ImagesDelete,
-}
+var (
+	imagesDeleteCmd = &cobra.Command{
+		Use:     "delete [repo:tag...]",
+		Aliases: []string{"d", "del"},
+		Short:   "Delete images",
+		Long: `Delete images interactively or by the list of repo:tag references.
+  examples:
+    azula img del -l name_part
+    azula img del app:pr-1 app:pr-2 --yes
+    azula img ls -o plain | grep pr- | azula img del -f - --yes --continue-on-error
+A summary of results is printed after deletion. The exit code is 1 if nothing was deleted
+and 3 if only some of the images were deleted.`,
+		Run: ImagesDelete,
+	}
+	deleteFromFile = ""
+	deleteYes      = false
+	deleteForce    = false
+	// continueOnError and confirmHost are shared by all deleting commands
+	continueOnError = false
+	confirmHost     = ""
+)
 
 func init() {
 	imagesCmd.AddCommand(imagesDeleteCmd)
+	imagesDeleteCmd.Flags().StringVarP(&deleteFromFile, "from-file", "f", "", "read repo:tag references from file, one per line ('-' for stdin)")
+	imagesDeleteCmd.Flags().BoolVarP(&deleteYes, "yes", "y", false, "do not ask for confirmation")
+	imagesDeleteCmd.Flags().BoolVar(&deleteForce, "force", false, "delete manifests shared with other tags when the registry can't delete a single tag")
+	imagesDeleteCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "keep deleting other images when one fails")
+	imagesDeleteCmd.Flags().StringVar(&confirmHost, "confirm-host", "", "host of a protected registry, required to delete from it with --yes")
 }
 
 func ImagesDelete(cmd *cobra.Command, args []string) {
 	ctx := context.TODO()
 
+	if len(args) > 0 || len(deleteFromFile) > 0 {
+		pickedTags, err := readImageRefs(args, deleteFromFile)
+		checkErr(err)
+		deleteImagesNonInteractive(ctx, pickedTags)
+		return
+	}
+
 	repos, err := meta.UC.ListReposLike(ctx, like, max_entries)
-	cobra.CheckErr(err)
-	pickedRepos := SurveyCheckboxes("In which repositories do you want to delete images?", repos)
+	checkErr(err)
+	pickedRepos := SurveyCheckboxes("In which repositories do you want to delete images?", usecase.RepositoryNames(repos))
 
-	repoTags, err := meta.UC.GetImagesWithTags(ctx, pickedRepos)
-	cobra.CheckErr(err)
-	pickedTags := SurveyCheckboxes("Which tags do you want to delete?", repoTags)
+	repoTags, err := meta.UC.GetImagesWithTags(ctx, repositories(pickedRepos))
+	checkErr(err)
+	pickedTags := pickTags(SurveyCheckboxes("Which tags do you want to delete?", tagNames(repoTags)), repoTags)
 
 	if len(pickedTags) < 1 {
 		fmt.Println("Tags for images", strings.Join(pickedRepos, ", "), "not found")
 		return
 	}
-	err = meta.UC.DeleteImageByTag(ctx, pickedTags)
-	cobra.CheckErr(err)
-	fmt.Println("Deleted next images:", strings.Join(pickedTags, ", "))
+	deleteImages(ctx, pickedTags, usecase.DeleteOptions{Force: deleteForce, ContinueOnError: continueOnError}, true)
+}
+
+func deleteImagesNonInteractive(ctx context.Context, refs []string) {
+	if len(refs) < 1 {
+		fmt.Println("Nothing to delete")
+		return
+	}
+	if !deleteYes && !dryRun && deleteFromFile == "-" {
+		checkErr(errors.New("can't ask for confirmation while reading from stdin, use --yes"))
+	}
+	pickedTags, err := usecase.ParseTags(refs)
+	checkErr(err)
+	deleteImages(ctx, pickedTags, usecase.DeleteOptions{Force: deleteForce, ContinueOnError: continueOnError}, !deleteYes)
+}
+
+// deleteImages is the single entry point of all deleting commands, in dry-run
+// mode it prints the resolved plan instead.
+func deleteImages(ctx context.Context, pickedTags []usecase.Tag, opts usecase.DeleteOptions, confirm bool) {
+	if !confirm && !dryRun {
+		checkConfirmHost(meta.Context)
+	}
+	plan, failed, err := meta.UC.PlanDelete(ctx, pickedTags, opts)
+	checkErr(err)
+	if dryRun || confirm {
+		printDeleteSummary(ctx, plan, failed, opts)
+	}
+	if dryRun {
+		fmt.Println("=> dry run, nothing deleted")
+		return
+	}
+	if len(plan) > 0 && confirm && !confirmDelete(len(pickedTags)) {
+		fmt.Println("=> aborted")
+		return
+	}
+	res, err := meta.UC.ApplyDeletePlan(ctx, plan, opts)
+	res = append(failed, res...)
+	rows := deleteResultRows(res)
+	printResults(os.Stdout, "REPOSITORY\tTAGS\tDIGEST\tSTATUS", rows)
+	exitOnFailures(rows, err, "Deleted", "deletions failed")
+}
+
+func printDeleteSummary(ctx context.Context, plan []usecase.DeletePlan, failed []usecase.DeleteResult, opts usecase.DeleteOptions) {
+	fmt.Println("Next manifests will be deleted:")
+	repo := ""
+	for _, p := range plan {
+		if p.Repo != repo {
+			repo = p.Repo
+			fmt.Printf("  %s\n", repo)
+		}
+		fmt.Printf("    %s (%s) tags: %s\n", p.Digest, p.Kind, strings.Join(p.Tags, ", "))
+		if len(p.Siblings) > 0 {
+			fmt.Printf("      WARN: shared with tags: %s\n", strings.Join(p.Siblings, ", "))
+		}
+	}
+	for _, v := range failed {
+		fmt.Printf("  WARN: skipping %s: %v\n", resultRef(v), v.Err)
+	}
+	size, err := meta.UC.EstimateReclaimable(ctx, plan, opts)
+	checkErr(err)
+	fmt.Println("Estimated reclaimable size:", humanSize(size))
+}
+
+func deleteResultRows(res []usecase.DeleteResult) []resultRow {
+	rows := make([]resultRow, 0, len(res))
+	for _, v := range res {
+		rows = append(rows, resultRow{
+			cells: []string{v.Repo, strings.Join(v.Tags, ","), shortDigest(v.Digest.String()), string(v.Status)},
+			err:   v.Err,
+			done:  v.Status == usecase.DeleteStatusDeleted,
+		})
+	}
+	return rows
+}
+
+func resultRef(v usecase.DeleteResult) string {
+	if len(v.Tags) < 1 {
+		return v.Repo
+	}
+	return v.Repo + ":" + strings.Join(v.Tags, ",")
+}
+
+// shortDigest keeps 12 hex chars of the digest like docker does for image IDs.
+func shortDigest(dgst string) string {
+	if i := strings.Index(dgst, ":"); i >= 0 && len(dgst) > i+13 {
+		return dgst[:i+13]
+	}
+	return dgst
+}
+
+// confirmDelete asks to type the registry host for protected registries or for
+// more than confirmThreshold tags, otherwise a simple yes/no is enough.
+func confirmDelete(count int) bool {
+	return confirmDeleteIn(meta.Context, count)
+}
+
+func confirmDeleteIn(c config.Context, count int) bool {
+	if !c.Protected && count <= confirmThreshold {
+		return SurveyConfirm(fmt.Sprintf("Delete %d images?", count))
+	}
+	host := registryHost(c.URL)
+	return SurveyInput(fmt.Sprintf("Type '%s' to delete %d images from it:", host, count)) == host
+}
+
+// checkConfirmHost fails deletions without confirmation from a protected registry,
+// unless the host of the registry is passed with --confirm-host.
+func checkConfirmHost(c config.Context) {
+	host := registryHost(c.URL)
+	if c.Protected && confirmHost != host {
+		checkErr(fmt.Errorf("registry %s is protected, pass --confirm-host %s to delete from it with --yes", host, host))
+	}
+}
+
+// readImageRefs merges references passed as arguments with the ones read from
+// path. Empty lines and lines starting with '#' are skipped.
+func readImageRefs(args []string, path string) ([]string, error) {
+	res := append([]string{}, args...)
+	if len(path) < 1 {
+		return res, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res, scanner.Err()
 }
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesExportCmd = &cobra.Command{
+		Use:   "export repo:tag...",
+		Short: "Export images to a tar archive without a docker daemon",
+		Long: `Write images to an OCI image layout or a docker archive tarball, which 'docker load' takes.
+The OCI layout keeps all the platforms of multi-arch images, a docker archive keeps one platform.
+  examples:
+    azula img export app:1.4.0 app:multi -o app.tar
+    azula img export app:multi --format docker-archive --platform linux/arm64 -o app.tar
+    azula img export app:1.4.0 -o - | ssh airgap 'cat > app.tar'`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  ImagesExport,
+	}
+	exportOutput   = ""
+	exportFormat   = ""
+	exportPlatform = ""
+)
+
+func init() {
+	imagesCmd.AddCommand(imagesExportCmd)
+	imagesExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "archive file, - writes to stdout")
+	imagesExportCmd.Flags().StringVar(&exportFormat, "format", string(usecase.ExportFormatOCI), "archive format: oci|docker-archive")
+	imagesExportCmd.Flags().StringVar(&exportPlatform, "platform", "", "export only the platform of multi-arch images, e.g. linux/arm64")
+	checkErr(imagesExportCmd.MarkFlagRequired("output"))
+}
+
+func ImagesExport(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+	refs, err := usecase.ParseTags(args)
+	checkErr(err)
+	opts := usecase.ExportOptions{Format: usecase.ExportFormat(exportFormat), Platform: exportPlatform}
+
+	if exportOutput == "-" {
+		_, err := meta.UC.Export(ctx, refs, os.Stdout, opts)
+		checkErr(err)
+		return
+	}
+	res, err := exportToFile(ctx, refs, exportOutput, opts)
+	checkErr(err)
+	fmt.Printf("Exported %d images, %d blobs (%s) to %s\n", res.Images, res.Blobs, humanSize(res.Size), exportOutput)
+}
+
+// exportToFile writes the archive next to the file and renames it once the export
+// succeeds, so a failed export doesn't leave a broken archive behind.
+func exportToFile(ctx context.Context, refs []usecase.Tag, name string, opts usecase.ExportOptions) (usecase.ExportResult, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return usecase.ExportResult{}, err
+	}
+	defer os.Remove(f.Name())
+	res, err := meta.UC.Export(ctx, refs, f, opts)
+	if err == nil {
+		// CreateTemp makes the file readable by the owner only
+		err = f.Chmod(0o644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return res, err
+	}
+	return res, os.Rename(f.Name(), name)
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesImportCmd = &cobra.Command{
+		Use:   "import file.tar",
+		Short: "Push images of an OCI layout or docker save tarball without a docker daemon",
+		Long: `Push images of an archive made by 'azula img export', 'docker save' or other tools writing the OCI image layout.
+Images are pushed under the names kept in the archive, --tag renames an archive holding a single image.
+Blobs the registry already has are skipped, so an interrupted import is resumed by running it again.
+  examples:
+    azula img import app.tar
+    azula img import hello-world.tar --tag test-1:v0.1 --tag test-2:v0.1`,
+		Args: cobra.ExactArgs(1),
+		Run:  ImagesImport,
+	}
+	importTags      = []string{}
+	importChunkSize = 0
+)
+
+func init() {
+	imagesCmd.AddCommand(imagesImportCmd)
+	imagesImportCmd.Flags().StringArrayVarP(&importTags, "tag", "t", nil, "repo:tag to push the image as, can be repeated")
+	imagesImportCmd.Flags().IntVar(&importChunkSize, "chunk-size", 16, "size of upload chunks in MiB")
+}
+
+func ImagesImport(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+	tags, err := usecase.ParseTags(importTags)
+	checkErr(err)
+	f, err := os.Open(args[0])
+	checkErr(err)
+	defer f.Close()
+	info, err := f.Stat()
+	checkErr(err)
+
+	opts := usecase.ImportOptions{Tags: tags, ChunkSize: int64(importChunkSize) << 20, DryRun: dryRun}
+	res, err := meta.UC.Import(ctx, f, info.Size(), opts)
+	if dryRun {
+		for _, v := range res {
+			fmt.Printf("%s (%s), blobs: %d missing, %d existing\n", v.Tag, v.Digest, len(v.Missing), v.Existing)
+			for _, dgst := range v.Missing {
+				fmt.Printf("  missing %s\n", dgst)
+			}
+		}
+		checkErr(err)
+		fmt.Println("=> dry run, nothing imported")
+		return
+	}
+	for _, v := range res {
+		fmt.Printf("Pushed %s (%s), blobs: %d uploaded, %d mounted, %d existing\n", v.Tag, v.Digest, v.Uploaded, v.Mounted, v.Existing)
+	}
+	checkErr(err)
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesInspectCmd = &cobra.Command{
+		Use:     "inspect repo:tag...",
+		Aliases: []string{"ins"},
+		Short:   "Show manifest, layers and config of images",
+		Args:    cobra.MinimumNArgs(1),
+		Run:     ImagesInspect,
+	}
+	inspectOutput   = ""
+	inspectPlatform = ""
+)
+
+func init() {
+	imagesCmd.AddCommand(imagesInspectCmd)
+	imagesInspectCmd.Flags().StringVarP(&inspectOutput, "output", "o", "", "output format: json (human readable if empty)")
+	imagesInspectCmd.Flags().StringVar(&inspectPlatform, "platform", "", "platform to show for multi-arch images, e.g. linux/arm64 (linux/amd64 if empty)")
+}
+
+func ImagesInspect(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+
+	if len(inspectOutput) > 0 {
+		checkErr(checkOutputFormat(inspectOutput, outputJSON))
+	}
+
+	refs, err := usecase.ParseTags(args)
+	checkErr(err)
+	res := make([]usecase.ImageDetails, 0, len(refs))
+	for _, v := range refs {
+		details, err := meta.UC.Inspect(ctx, v, inspectPlatform)
+		checkErr(err)
+		res = append(res, details)
+	}
+
+	if inspectOutput == outputJSON {
+		checkErr(printJSON(os.Stdout, res))
+		return
+	}
+	for i, v := range res {
+		if i > 0 {
+			fmt.Println()
+		}
+		printImageDetails(os.Stdout, v)
+	}
+}
+
+func printImageDetails(w io.Writer, d usecase.ImageDetails) {
+	tw := newTabWriter(w)
+	platform := d.OS + "/" + d.Architecture
+	if len(d.Variant) > 0 {
+		platform += "/" + d.Variant
+	}
+	fmt.Fprintf(tw, "Name:\t%s:%s\n", d.Repo, d.Tag)
+	fmt.Fprintf(tw, "Digest:\t%s\n", d.Digest)
+	fmt.Fprintf(tw, "Media type:\t%s\n", d.MediaType)
+	if len(d.PlatformDigest) > 0 {
+		fmt.Fprintf(tw, "Platform digest:\t%s\n", d.PlatformDigest)
+	}
+	fmt.Fprintf(tw, "Created:\t%s\n", formatCreated(d.Created))
+	fmt.Fprintf(tw, "Platform:\t%s\n", platform)
+	fmt.Fprintf(tw, "Size:\t%s\n", humanSize(d.TotalSize))
+	if len(d.User) > 0 {
+		fmt.Fprintf(tw, "User:\t%s\n", d.User)
+	}
+	if len(d.WorkingDir) > 0 {
+		fmt.Fprintf(tw, "Working dir:\t%s\n", d.WorkingDir)
+	}
+	fmt.Fprintf(tw, "Entrypoint:\t%s\n", formatCommand(d.Entrypoint))
+	fmt.Fprintf(tw, "Cmd:\t%s\n", formatCommand(d.Cmd))
+	checkErr(tw.Flush())
+
+	printSection(w, "Env", d.Env)
+	printSection(w, "Exposed ports", d.ExposedPorts)
+	labels := make([]string, 0, len(d.Labels))
+	for k, v := range d.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	printSection(w, "Labels", labels)
+
+	if len(d.Platforms) > 1 {
+		fmt.Fprintf(w, "Platforms(%d):\n", len(d.Platforms))
+		tw = newTabWriter(w)
+		for _, p := range d.Platforms {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", p.Platform, p.Digest, humanSize(p.Size))
+		}
+		checkErr(tw.Flush())
+	}
+
+	fmt.Fprintf(w, "Layers(%d):\n", len(d.Layers))
+	tw = newTabWriter(w)
+	for _, l := range d.Layers {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", l.Digest, humanSize(l.Size), l.MediaType)
+	}
+	checkErr(tw.Flush())
+}
+
+func printSection(w io.Writer, name string, lines []string) {
+	if len(lines) < 1 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", name)
+	for _, v := range lines {
+		fmt.Fprintf(w, "  %s\n", v)
+	}
+}
+
+func formatCommand(args []string) string {
+	if len(args) < 1 {
+		return "-"
+	}
+	return fmt.Sprintf("[%s]", strings.Join(args, " "))
+}
@@ -2,33 +2,67 @@ package cli
 
 import (
 	"context"
+	"os"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
 
 	"github.com/spf13/cobra"
 )
 
-var imagesListCmd = &cobra.Command{
-	Use:     "list",
-	Aliases: []string{"l", "ls"},
-	Short:   "List images",
-	Run:     ImagesList,
-}
+var (
+	imagesListCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l", "ls"},
+		Short:   "List images",
+		Long: `List images interactively or print them in the given output format.
+  examples:
+    azula img ls -l name_part
+    azula img ls -l name_part -o json`,
+		Run: ImagesList,
+	}
+	listOutput   = ""
+	listPlatform = ""
+)
 
 func init() {
 	imagesCmd.AddCommand(imagesListCmd)
+	imagesListCmd.Flags().StringVarP(&listOutput, "output", "o", "", "output format: plain|json|yaml|table|wide (interactive if empty)")
+	imagesListCmd.Flags().StringVar(&listPlatform, "platform", "", "show only images having the platform, e.g. linux/arm64")
 }
 
 func ImagesList(cmd *cobra.Command, args []string) {
 	ctx := context.TODO()
 
+	if len(listOutput) > 0 {
+		checkErr(checkOutputFormat(listOutput, outputPlain, outputJSON, outputYAML, outputTable, outputWide))
+	}
+
 	repos, err := meta.UC.ListReposLike(ctx, like, max_entries)
-	cobra.CheckErr(err)
+	checkErr(err)
+
+	if len(listOutput) > 0 {
+		checkErr(printImages(os.Stdout, listOutput, listImages(ctx, repos)))
+		return
+	}
 BACK:
-	pickedRepos := SurveyList("In which repositories do you want to list images?", repos)
+	pickedRepos := SurveyList("In which repositories do you want to list images?", usecase.RepositoryNames(repos))
 
-	repoTags, err := meta.UC.GetImagesWithTags(ctx, []string{pickedRepos})
-	cobra.CheckErr(err)
+	repoTags := make([]string, 0, 4)
+	for _, v := range listImages(ctx, repositories([]string{pickedRepos})) {
+		repoTags = append(repoTags, v.Tag.String())
+	}
 	back := SurveyList("Found images:", append(repoTags, mgmtBack))
 	if back == mgmtBack {
 		goto BACK
 	}
 }
+
+func listImages(ctx context.Context, repos []usecase.Repository) []usecase.Image {
+	opts := usecase.ListOptions{
+		Describe: len(listOutput) > 0 && listOutput != outputPlain && listOutput != outputTable,
+		Platform: listPlatform,
+	}
+	images, err := meta.UC.ListImages(ctx, repos, opts)
+	checkErr(err)
+	return images
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete images by retention rules",
+		Long: `Delete images of repositories matched by --like according to retention rules.
+Rules are applied per repository, the age of an image is taken from the 'created' field of its config,
+images without it are always kept.
+  examples:
+    azula img prune -l app --keep-last 10
+    azula img prune -l app --older-than 30d --exclude-regex '^(latest|v[0-9.]+)$' --yes`,
+		Run: ImagesPrune,
+	}
+	pruneKeepLast     = 0
+	pruneOlderThan    = ""
+	pruneTagRegex     = ""
+	pruneExcludeRegex = ""
+	prunePlatform     = ""
+	pruneYes          = false
+	pruneForce        = false
+)
+
+func init() {
+	imagesCmd.AddCommand(imagesPruneCmd)
+	imagesPruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "keep N newest tags of every repository")
+	imagesPruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "delete only images older than duration, e.g. 12h, 30d, 2w")
+	imagesPruneCmd.Flags().StringVar(&pruneTagRegex, "tag-regex", "", "consider only tags matching regex")
+	imagesPruneCmd.Flags().StringVar(&pruneExcludeRegex, "exclude-regex", "", "never touch tags matching regex")
+	imagesPruneCmd.Flags().StringVar(&prunePlatform, "platform", "", "consider only tags having the platform, e.g. linux/arm64")
+	imagesPruneCmd.Flags().BoolVarP(&pruneYes, "yes", "y", false, "do not ask for confirmation")
+	imagesPruneCmd.Flags().BoolVar(&pruneForce, "force", false, "delete manifests shared with other tags when the registry can't delete a single tag")
+	imagesPruneCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "keep deleting other images when one fails")
+	imagesPruneCmd.Flags().StringVar(&confirmHost, "confirm-host", "", "host of a protected registry, required to delete from it with --yes")
+}
+
+func ImagesPrune(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+
+	rules, err := pruneRulesFromFlags()
+	checkErr(err)
+
+	repos, err := meta.UC.ListReposLike(ctx, like, max_entries)
+	checkErr(err)
+
+	plan, err := meta.UC.PlanPrune(ctx, repos, rules)
+	checkErr(err)
+
+	pickedTags := make([]usecase.Tag, 0, len(plan))
+	tw := newTabWriter(os.Stdout)
+	fmt.Fprintln(tw, "REPOSITORY\tTAG\tCREATED\tACTION")
+	for _, v := range plan {
+		action := "keep (" + v.Reason + ")"
+		if v.Delete {
+			action = "delete"
+			pickedTags = append(pickedTags, v.Tag)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Repo, v.Name, formatCreated(v.Created), action)
+	}
+	checkErr(tw.Flush())
+
+	if len(pickedTags) < 1 {
+		fmt.Println("Nothing to prune")
+		return
+	}
+	deleteImages(ctx, pickedTags, usecase.DeleteOptions{Force: pruneForce, ContinueOnError: continueOnError}, !pruneYes)
+}
+
+func pruneRulesFromFlags() (usecase.PruneRules, error) {
+	rules := usecase.PruneRules{KeepLast: pruneKeepLast, Platform: prunePlatform}
+	var err error
+	if len(pruneOlderThan) > 0 {
+		rules.OlderThan, err = parseAge(pruneOlderThan)
+		if err != nil {
+			return rules, err
+		}
+	}
+	if len(pruneTagRegex) > 0 {
+		rules.TagRegex, err = regexp.Compile(pruneTagRegex)
+		if err != nil {
+			return rules, err
+		}
+	}
+	if len(pruneExcludeRegex) > 0 {
+		rules.ExcludeRegex, err = regexp.Compile(pruneExcludeRegex)
+		if err != nil {
+			return rules, err
+		}
+	}
+	return rules, nil
+}
+
+// parseAge extends time.ParseDuration with days (d) and weeks (w) units.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			v, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration '%s'", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
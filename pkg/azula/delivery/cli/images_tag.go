@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesTagCmd = &cobra.Command{
+		Use:   "tag src-repo:tag dst-repo:tag",
+		Short: "Tag an image with a new name without pulling it",
+		Long: `Put the manifest of the source under the destination tag.
+Across repositories blobs are mounted from the source repository, multi-arch indexes are copied with all the platforms.
+  examples:
+    azula img tag app:rc-5 app:1.4.0
+    azula img tag app:1.4.0 release/app:1.4.0`,
+		Args: cobra.ExactArgs(2),
+		Run:  ImagesTag,
+	}
+	imagesCopyCmd = &cobra.Command{
+		Use:   "cp src-repo:tag dst-repo[:tag]",
+		Short: "Copy an image to another repository",
+		Long: `Copy an image to another repository, the tag of the source is kept if the destination has no tag.
+  examples:
+    azula img cp app:1.4.0 release/app
+    azula img cp app:1.4.0 release/app:stable`,
+		Args: cobra.ExactArgs(2),
+		Run:  ImagesCopy,
+	}
+	tagOverwrite = false
+)
+
+func init() {
+	imagesCmd.AddCommand(imagesTagCmd, imagesCopyCmd)
+	for _, c := range []*cobra.Command{imagesTagCmd, imagesCopyCmd} {
+		c.Flags().BoolVar(&tagOverwrite, "overwrite", false, "move the destination tag if it points at another image")
+	}
+}
+
+func ImagesTag(cmd *cobra.Command, args []string) {
+	src, err := usecase.ParseTag(args[0])
+	checkErr(err)
+	dst, err := usecase.ParseTag(args[1])
+	checkErr(err)
+	copyImage(context.TODO(), src, dst)
+}
+
+func ImagesCopy(cmd *cobra.Command, args []string) {
+	src, err := usecase.ParseTag(args[0])
+	checkErr(err)
+	dst := usecase.Tag{Repo: args[1], Name: src.Name}
+	if strings.Contains(args[1][strings.LastIndex(args[1], "/")+1:], ":") {
+		dst, err = usecase.ParseTag(args[1])
+		checkErr(err)
+	}
+	copyImage(context.TODO(), src, dst)
+}
+
+func copyImage(ctx context.Context, src, dst usecase.Tag) {
+	if dryRun {
+		fmt.Printf("%s would be copied to %s\n", src, dst)
+		fmt.Println("=> dry run, nothing copied")
+		return
+	}
+	res, err := meta.UC.Copy(ctx, src, dst, usecase.CopyOptions{Overwrite: tagOverwrite})
+	checkErr(err)
+	if res.Unchanged {
+		fmt.Printf("%s already points at %s\n", dst, res.Digest)
+		return
+	}
+	fmt.Printf("Copied %s to %s (%s)\n", src, dst, res.Digest)
+	if src.Repo != dst.Repo {
+		fmt.Printf("Blobs: %d mounted, %d uploaded, %d existing\n", res.Mounted, res.Uploaded, res.Existing)
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nikgalkin/azula/pkg/azula/config"
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	loginCmd = &cobra.Command{
+		Use:   "login [registry]",
+		Short: "Log in to a registry",
+		Long: `Verify credentials against the registry and store them like 'docker login' does:
+in the credsStore/credHelpers of the docker config or in its auths.
+The registry is a context name or an address (https is assumed without a scheme),
+by default the registry is picked like for other commands.
+  example:
+    azula login registry.domain.com -u user
+    echo "$TOKEN" | azula login --context prod -u user --password-stdin`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{annotationNoRegistry: ""},
+		Run:         Login,
+	}
+	logoutCmd = &cobra.Command{
+		Use:   "logout [registry]",
+		Short: "Log out from a registry",
+		Long: `Remove stored credentials of the registry from the docker config and its credential helper.
+  example:
+    azula logout registry.domain.com`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{annotationNoRegistry: ""},
+		Run:         Logout,
+	}
+	loginUsername      = ""
+	loginPassword      = ""
+	loginPasswordStdin = false
+)
+
+func init() {
+	rootCmd.AddCommand(loginCmd, logoutCmd)
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "username")
+	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "password or token")
+	loginCmd.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "take the password from stdin")
+}
+
+func Login(cmd *cobra.Command, args []string) {
+	checkNoDryRun(cmd)
+	if loginPasswordStdin {
+		if len(loginPassword) > 0 {
+			checkErr("--password and --password-stdin are mutually exclusive")
+		}
+		if len(loginUsername) < 1 {
+			checkErr("--username is required with --password-stdin")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		checkErr(err)
+		loginPassword = strings.TrimRight(string(data), "\r\n")
+	}
+	uc, c := authUsecase(args)
+	if len(loginUsername) < 1 {
+		loginUsername = SurveyInput("Username:")
+	}
+	if len(loginPassword) < 1 {
+		loginPassword = SurveyPassword("Password:")
+	}
+	checkErr(uc.Login(context.Background(), loginUsername, loginPassword))
+	fmt.Printf("Login to %s succeeded\n", registryHost(c.URL))
+}
+
+func Logout(cmd *cobra.Command, args []string) {
+	checkNoDryRun(cmd)
+	uc, c := authUsecase(args)
+	checkErr(uc.Logout(context.Background()))
+	fmt.Printf("Removed credentials of %s\n", registryHost(c.URL))
+}
+
+// checkNoDryRun fails commands, which can't show what they would change.
+func checkNoDryRun(cmd *cobra.Command) {
+	if dryRun {
+		checkErr(fmt.Errorf("%s doesn't support --dry-run", cmd.CommandPath()))
+	}
+}
+
+// authUsecase resolves the registry of login/logout: a context name, an address or the usual order of rootCmd.
+func authUsecase(args []string) (usecase.AuthUsecase, config.Context) {
+	var c config.Context
+	if len(args) > 0 {
+		c = namedContext(args[0])
+	} else {
+		var err error
+		c, err = resolveContext(meta.Config)
+		checkErr(err)
+		c.TLS.InsecureSkipVerify = c.TLS.InsecureSkipVerify || insecureFlag
+		applyTransportFlags(&c)
+	}
+	uc, err := meta.newAuth(c)
+	checkErr(err)
+	return uc, c
+}
+
+// namedContext returns the context with the name or, if there is no such context,
+// a context of the registry address (https is assumed without a scheme).
+func namedContext(name string) config.Context {
+	c, ok := meta.Config.Get(name)
+	if !ok {
+		c = config.Context{Name: name, URL: name}
+		if !strings.Contains(c.URL, "://") {
+			c.URL = "https://" + c.URL
+		}
+	}
+	c.Protected = c.Protected || isProtected(c.URL)
+	c.TLS.InsecureSkipVerify = c.TLS.InsecureSkipVerify || insecureFlag
+	applyTransportFlags(&c)
+	return c
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputPlain = "plain"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+	outputWide  = "wide"
+)
+
+// exitPartialFailure is the exit code of commands which failed after applying some of the items.
+const exitPartialFailure = 3
+
+func checkOutputFormat(format string, allowed ...string) error {
+	for _, v := range allowed {
+		if format == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format '%s', expected one of %v", format, allowed)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printYAML(w io.Writer, v interface{}) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(v)
+}
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+}
+
+func printImages(w io.Writer, format string, images []usecase.Image) error {
+	switch format {
+	case outputJSON:
+		return printJSON(w, images)
+	case outputYAML:
+		return printYAML(w, images)
+	case outputTable:
+		tw := newTabWriter(w)
+		fmt.Fprintln(tw, "REPOSITORY\tTAG")
+		for _, v := range images {
+			fmt.Fprintf(tw, "%s\t%s\n", v.Repo, v.Name)
+		}
+		return tw.Flush()
+	case outputWide:
+		tw := newTabWriter(w)
+		fmt.Fprintln(tw, "REPOSITORY\tTAG\tKIND\tDIGEST\tSIZE\tCREATED\tMEDIA TYPE\tPLATFORMS")
+		for _, v := range images {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				v.Repo, v.Name, v.Kind, v.Digest, v.Size, formatCreated(v.Created), v.MediaType, formatPlatforms(v.Platforms))
+		}
+		return tw.Flush()
+	default:
+		for _, v := range images {
+			fmt.Fprintln(w, v.Tag.String())
+		}
+		return nil
+	}
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatCreated(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatPlatforms(platforms []usecase.PlatformInfo) string {
+	res := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		res = append(res, fmt.Sprintf("%s(%s)", p.Platform, humanSize(p.Size)))
+	}
+	return strings.Join(res, ",")
+}
+
+// resultRow is a line of the results of a command applied to many items.
+type resultRow struct {
+	cells []string
+	err   error
+	// done is set if the item was applied
+	done bool
+}
+
+// printResults prints the rows under the header with an error column, hints of
+// the errors are printed once after the table.
+func printResults(w io.Writer, header string, rows []resultRow) {
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, header+"\tERROR")
+	for _, v := range rows {
+		errMsg := ""
+		if v.err != nil {
+			errMsg = v.err.Error()
+		}
+		fmt.Fprintln(tw, strings.Join(append(v.cells, errMsg), "\t"))
+	}
+	checkErr(tw.Flush())
+
+	hints := map[string]bool{}
+	for _, v := range rows {
+		if hint := errorHint(docker.FromError(v.err)); len(hint) > 0 && !hints[hint] {
+			hints[hint] = true
+			fmt.Fprintln(w, "Hint:", hint)
+		}
+	}
+}
+
+// exitOnFailures prints how many of the rows are done, e.g. "Deleted 2 of 3". It exits
+// with exitPartialFailure if some rows are done before a failure and with 1 if none are.
+// failed describes the failed rows in the error, e.g. "deletions failed".
+func exitOnFailures(rows []resultRow, err error, done, failed string) {
+	n := 0
+	for _, v := range rows {
+		if v.done {
+			n++
+		}
+	}
+	fmt.Printf("%s %d of %d\n", done, n, len(rows))
+	if n == len(rows) && err == nil {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("%d of %d %s", len(rows)-n, len(rows), failed)
+	}
+	// hints are printed with the results already
+	fmt.Fprintln(os.Stderr, "Error:", docker.FromError(err))
+	if n > 0 {
+		os.Exit(exitPartialFailure)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	repoCmd = &cobra.Command{
+		Use:     "repo",
+		Aliases: []string{"repos", "r"},
+		Short:   "Manipulate with repositories",
+		Run:     Images,
+	}
+	repoMoveCmd = &cobra.Command{
+		Use:     "mv regex replacement",
+		Aliases: []string{"move"},
+		Short:   "Rename repositories by a regex rewrite rule",
+		Long: `Copy every tag of the repositories matching regex to the repositories named by replacement,
+which may refer to submatches as $1 or ${name}. Source tags are deleted only with --delete-source,
+after the digests of both tags are verified.
+  examples:
+    azula repo mv '^team-a/(.*)$' 'platform/team-a/$1' --dry-run
+    azula repo mv '^team-a/(.*)$' 'platform/team-a/$1' --delete-source --yes`,
+		Args: cobra.ExactArgs(2),
+		Run:  RepoMove,
+	}
+	moveDeleteSource = false
+	moveOverwrite    = false
+	moveYes          = false
+)
+
+func init() {
+	rootCmd.AddCommand(repoCmd)
+	repoCmd.AddCommand(repoMoveCmd)
+	repoCmd.PersistentFlags().IntVarP(&max_entries, "entries", "e", 500, "set max entries of repositories")
+	repoCmd.PersistentFlags().IntVar(&confirmThreshold, "confirm-threshold", 10, "deleting more tags requires typing the registry host to confirm")
+	repoMoveCmd.Flags().BoolVar(&moveDeleteSource, "delete-source", false, "delete the source tags after they are copied")
+	repoMoveCmd.Flags().BoolVar(&moveOverwrite, "overwrite", false, "move destination tags pointing at other images")
+	repoMoveCmd.Flags().BoolVarP(&moveYes, "yes", "y", false, "do not ask for confirmation")
+	repoMoveCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "keep moving other tags when one fails")
+	repoMoveCmd.Flags().StringVar(&confirmHost, "confirm-host", "", "host of a protected registry, required to delete from it with --yes")
+}
+
+func RepoMove(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+	pattern, err := regexp.Compile(args[0])
+	checkErr(err)
+	rule := usecase.MoveRule{Pattern: pattern, Replacement: args[1]}
+	if moveYes && moveDeleteSource && !dryRun {
+		checkConfirmHost(meta.Context)
+	}
+
+	items, err := meta.UC.PlanMove(ctx, rule, max_entries)
+	checkErr(err)
+	if len(items) < 1 {
+		fmt.Println("No repositories match", args[0])
+		return
+	}
+	tw := newTabWriter(os.Stdout)
+	fmt.Fprintln(tw, "SOURCE\tDESTINATION\tDIGEST")
+	for _, v := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Src, v.Dst, shortDigest(v.Digest.String()))
+	}
+	checkErr(tw.Flush())
+	if moveDeleteSource {
+		fmt.Println("Source tags will be deleted after they are copied")
+	}
+
+	if dryRun {
+		fmt.Println("=> dry run, nothing moved")
+		return
+	}
+	if !moveYes && !confirmMove(len(items)) {
+		fmt.Println("=> aborted")
+		return
+	}
+	opts := usecase.MoveOptions{
+		Overwrite:       moveOverwrite,
+		DeleteSource:    moveDeleteSource,
+		ContinueOnError: continueOnError,
+	}
+	res, err := meta.UC.ApplyMove(ctx, items, opts)
+	rows := moveResultRows(res)
+	printResults(os.Stdout, "SOURCE\tDESTINATION\tSTATUS", rows)
+	exitOnFailures(rows, err, "Moved", "tags failed to move")
+}
+
+func confirmMove(count int) bool {
+	if moveDeleteSource {
+		return confirmDelete(count)
+	}
+	return SurveyConfirm(fmt.Sprintf("Copy %d tags?", count))
+}
+
+// moveResultRows counts a tag copied without deleting the source, when it was
+// requested, as a failure.
+func moveResultRows(res []usecase.MoveResult) []resultRow {
+	rows := make([]resultRow, 0, len(res))
+	for _, v := range res {
+		rows = append(rows, resultRow{
+			cells: []string{v.Src.String(), v.Dst.String(), string(v.Status)},
+			err:   v.Err,
+			done:  v.Err == nil && (v.Status == usecase.MoveStatusMoved || v.Status == usecase.MoveStatusCopied && !moveDeleteSource),
+		})
+	}
+	return rows
+}
@@ -1,8 +1,13 @@
 package cli
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/nikgalkin/azula/pkg/azula/config"
 	"github.com/nikgalkin/azula/pkg/azula/usecase"
 
 	"github.com/spf13/cobra"
@@ -12,30 +17,74 @@ type CliHandler interface {
 	Execute()
 }
 
+// UsecaseFactory connects to the registry of the context.
+type UsecaseFactory func(config.Context) (usecase.ManUsecase, error)
+
+// AuthFactory manages credentials of the registry of the context.
+type AuthFactory func(config.Context) (usecase.AuthUsecase, error)
+
+// SyncFactory connects to the source and the destination registries of a sync.
+type SyncFactory func(from, to config.Context) (usecase.SyncUsecase, error)
+
 type cli struct {
-	UC usecase.ManUsecase
+	UC      usecase.ManUsecase
+	Context config.Context
+	Config  *config.Config
+	newUC   UsecaseFactory
+	newAuth AuthFactory
+	newSync SyncFactory
 }
 
-func New(uc usecase.ManUsecase) CliHandler {
+func New(newUC UsecaseFactory, newAuth AuthFactory, newSync SyncFactory) CliHandler {
 	return &cli{
-		UC: uc,
+		newUC:   newUC,
+		newAuth: newAuth,
+		newSync: newSync,
 	}
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "azula",
 	Short: "Manipulates with docker registry objects",
-	Long: `Use environment variable AZULA_REGISTRY to pass registry address. By default http://127.0.0.1:5000
+	Long: `The registry is picked in the next order: --registry flag, --context flag, AZULA_REGISTRY environment variable,
+the current context of the config file (see 'azula context'). By default http://127.0.0.1:5000
+Use AZULA_PROTECTED_REGISTRIES to pass comma separated hosts of registries, which require typing the host to confirm deletion
+or passing it with --confirm-host along with --yes.
   example:
-    export AZULA_REGISTRY=https://some-registry.domain.com`,
+    export AZULA_REGISTRY=https://some-registry.domain.com
+    export AZULA_PROTECTED_REGISTRIES=some-registry.domain.com`,
+	PersistentPreRun: InitRegistry,
 }
 
 var (
-	meta = &cli{}
+	meta         = &cli{}
+	dryRun       = false
+	registryFlag = ""
+	contextFlag  = ""
+	insecureFlag = false
+	retriesFlag  = 0
+	timeoutFlag  = time.Duration(0)
+	concurrency  = 0
+	rateLimit    = 0.0
 )
 
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would be changed without changing anything")
+	rootCmd.PersistentFlags().StringVar(&registryFlag, "registry", "", "registry address, overrides the context")
+	rootCmd.PersistentFlags().StringVar(&contextFlag, "context", "", "name of the context to use")
+	rootCmd.PersistentFlags().BoolVar(&insecureFlag, "insecure-skip-tls-verify", false, "don't verify the registry certificate")
+	rootCmd.PersistentFlags().IntVar(&retriesFlag, "retry-attempts", 0, "max attempts of a request failed with a transient error, 1 disables retries (default 4)")
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 0, "max number of registry calls at once (default 8)")
+	rootCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "max requests per second to the registry, no limit if zero")
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 0, "timeout of a single request attempt waiting for the response, e.g. 30s")
+}
+
 const (
 	mgmtBack = "<= back"
+
+	defaultRegistry = "http://127.0.0.1:5000"
+	// annotationNoRegistry marks commands, which don't connect to the registry
+	annotationNoRegistry = "azula/no-registry"
 )
 
 func (c *cli) Execute() {
@@ -45,3 +94,98 @@ func (c *cli) Execute() {
 		os.Exit(1)
 	}
 }
+
+func InitRegistry(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	checkErr(err)
+	meta.Config = cfg
+	if !needsRegistry(cmd) {
+		return
+	}
+
+	meta.Context, err = resolveContext(cfg)
+	checkErr(err)
+	meta.Context.Protected = meta.Context.Protected || isProtected(meta.Context.URL)
+	meta.Context.TLS.InsecureSkipVerify = meta.Context.TLS.InsecureSkipVerify || insecureFlag
+	applyTransportFlags(&meta.Context)
+	applyDefaults(cmd, meta.Context.Defaults)
+
+	meta.UC, err = meta.newUC(meta.Context)
+	checkErr(err)
+}
+
+func needsRegistry(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return false
+	}
+	for c := cmd; c != nil; c = c.Parent() {
+		if _, ok := c.Annotations[annotationNoRegistry]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveContext picks the context in the order described in the help of rootCmd.
+func resolveContext(cfg *config.Config) (config.Context, error) {
+	if len(registryFlag) > 0 {
+		return config.Context{Name: registryFlag, URL: registryFlag}, nil
+	}
+	name := contextFlag
+	if len(name) < 1 {
+		if registry := os.Getenv("AZULA_REGISTRY"); len(registry) > 0 {
+			return config.Context{Name: registry, URL: registry}, nil
+		}
+		name = cfg.CurrentContext
+	}
+	if len(name) < 1 {
+		return config.Context{Name: defaultRegistry, URL: defaultRegistry}, nil
+	}
+	c, ok := cfg.Get(name)
+	if !ok {
+		return c, fmt.Errorf("context '%s' not found", name)
+	}
+	return c, nil
+}
+
+func isProtected(registry string) bool {
+	host := registryHost(registry)
+	for _, v := range strings.Split(os.Getenv("AZULA_PROTECTED_REGISTRIES"), ",") {
+		if strings.TrimSpace(v) == host {
+			return true
+		}
+	}
+	return false
+}
+
+func registryHost(registry string) string {
+	if u, err := url.Parse(registry); err == nil && len(u.Host) > 0 {
+		return u.Host
+	}
+	return registry
+}
+
+func applyTransportFlags(c *config.Context) {
+	if retriesFlag > 0 {
+		c.Retry.Attempts = retriesFlag
+	}
+	if timeoutFlag > 0 {
+		c.Timeout = timeoutFlag
+	}
+	if concurrency > 0 {
+		c.Concurrency = concurrency
+	}
+	if rateLimit > 0 {
+		c.RateLimit = rateLimit
+	}
+}
+
+func applyDefaults(cmd *cobra.Command, d config.Defaults) {
+	if f := cmd.Flags().Lookup("like"); f != nil && !f.Changed && len(d.Like) > 0 {
+		like = d.Like
+	}
+	if f := cmd.Flags().Lookup("entries"); f != nil && !f.Changed && d.Entries > 0 {
+		max_entries = d.Entries
+	}
+}
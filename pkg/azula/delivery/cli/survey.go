@@ -35,6 +35,36 @@ func SurveyList(label string, opts []string) string {
 	return res
 }
 
+func SurveyConfirm(label string) bool {
+	res := false
+	prompt := &survey.Confirm{
+		Message: label,
+		Help:    surveyHelp,
+	}
+	surveyCheckErr(survey.AskOne(prompt, &res))
+	return res
+}
+
+func SurveyInput(label string) string {
+	res := ""
+	prompt := &survey.Input{
+		Message: label,
+		Help:    surveyHelp,
+	}
+	surveyCheckErr(survey.AskOne(prompt, &res))
+	return res
+}
+
+func SurveyPassword(label string) string {
+	res := ""
+	prompt := &survey.Password{
+		Message: label,
+		Help:    surveyHelp,
+	}
+	surveyCheckErr(survey.AskOne(prompt, &res))
+	return res
+}
+
 func labelWithCount(label string, opts []string) string {
 	return fmt.Sprintf("%s(%d)", label, len(opts))
 }
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/nikgalkin/azula/pkg/azula/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Replicate repositories from one registry to another",
+		Long: `Copy tags of the matched repositories from the --from registry to the --to one.
+Registries are context names or addresses (https is assumed without a scheme).
+Tags and blobs already present in the destination are skipped, so an interrupted sync is resumed by running it again.
+  examples:
+    azula sync --from ci --to prod --include '^team-a/' --tag-regex '^v[0-9.]+$' --dry-run
+    azula sync --from ci --to prod --include '^team-a/' --delete-extraneous --yes`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{annotationNoRegistry: ""},
+		Run:         Sync,
+	}
+	syncFrom             = ""
+	syncTo               = ""
+	syncInclude          = ""
+	syncExclude          = ""
+	syncTagRegex         = ""
+	syncExcludeTagRegex  = ""
+	syncDeleteExtraneous = false
+	syncEntries          = 0
+	syncYes              = false
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVar(&syncFrom, "from", "", "source registry")
+	syncCmd.Flags().StringVar(&syncTo, "to", "", "destination registry")
+	syncCmd.Flags().StringVar(&syncInclude, "include", "", "sync only repositories matching regex")
+	syncCmd.Flags().StringVar(&syncExclude, "exclude", "", "never touch repositories matching regex")
+	syncCmd.Flags().StringVar(&syncTagRegex, "tag-regex", "", "sync only tags matching regex")
+	syncCmd.Flags().StringVar(&syncExcludeTagRegex, "exclude-tag-regex", "", "never touch tags matching regex")
+	syncCmd.Flags().BoolVar(&syncDeleteExtraneous, "delete-extraneous", false, "delete tags of the destination missing in the source")
+	syncCmd.Flags().IntVarP(&syncEntries, "entries", "e", 500, "set max entries of repositories")
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "do not ask for confirmation of deletions")
+	syncCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "keep syncing other tags when one fails")
+	syncCmd.Flags().StringVar(&confirmHost, "confirm-host", "", "host of the protected destination, required to delete from it with --yes")
+	checkErr(syncCmd.MarkFlagRequired("from"))
+	checkErr(syncCmd.MarkFlagRequired("to"))
+}
+
+func Sync(cmd *cobra.Command, args []string) {
+	ctx := context.TODO()
+	opts, err := syncOptionsFromFlags()
+	checkErr(err)
+	from, to := namedContext(syncFrom), namedContext(syncTo)
+	if from.URL == to.URL {
+		checkErr(fmt.Errorf("source and destination are the same registry %s", from.URL))
+	}
+	if syncYes && syncDeleteExtraneous && !dryRun {
+		checkConfirmHost(to)
+	}
+	uc, err := meta.newSync(from, to)
+	checkErr(err)
+
+	items, err := uc.PlanSync(ctx, opts)
+	checkErr(err)
+	deletes, pending := 0, 0
+	tw := newTabWriter(os.Stdout)
+	fmt.Fprintln(tw, "REPOSITORY\tTAG\tDIGEST\tACTION")
+	for _, v := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Repo, v.Name, shortDigest(v.Digest.String()), v.Action)
+		switch v.Action {
+		case usecase.SyncActionDelete:
+			deletes++
+		case usecase.SyncActionCopy, usecase.SyncActionUpdate:
+			pending++
+		}
+	}
+	checkErr(tw.Flush())
+
+	if dryRun {
+		fmt.Println("=> dry run, nothing synced")
+		return
+	}
+	if pending+deletes < 1 {
+		fmt.Println("Everything is up to date")
+		return
+	}
+	if deletes > 0 && !syncYes && !confirmDeleteIn(to, deletes) {
+		fmt.Println("=> aborted")
+		return
+	}
+	res, err := uc.ApplySync(ctx, items, opts)
+	rows := syncResultRows(res)
+	printResults(os.Stdout, "REPOSITORY\tTAG\tACTION\tSTATUS\tBLOBS", rows)
+	exitOnFailures(rows, err, "Synced", "tags failed to sync")
+}
+
+func syncOptionsFromFlags() (usecase.SyncOptions, error) {
+	opts := usecase.SyncOptions{
+		DeleteExtraneous: syncDeleteExtraneous,
+		MaxEntries:       syncEntries,
+		ContinueOnError:  continueOnError,
+	}
+	for _, v := range []struct {
+		expr string
+		re   **regexp.Regexp
+	}{
+		{syncInclude, &opts.Include},
+		{syncExclude, &opts.Exclude},
+		{syncTagRegex, &opts.TagRegex},
+		{syncExcludeTagRegex, &opts.ExcludeTagRegex},
+	} {
+		if len(v.expr) < 1 {
+			continue
+		}
+		re, err := regexp.Compile(v.expr)
+		if err != nil {
+			return opts, err
+		}
+		*v.re = re
+	}
+	return opts, nil
+}
+
+// syncResultRows skips up to date tags, they are neither printed nor counted.
+func syncResultRows(res []usecase.SyncResult) []resultRow {
+	rows := make([]resultRow, 0, len(res))
+	for _, v := range res {
+		if v.Action == usecase.SyncActionUpToDate {
+			continue
+		}
+		blobs := ""
+		if v.Action != usecase.SyncActionDelete && v.Status == usecase.SyncStatusDone {
+			blobs = fmt.Sprintf("%d uploaded, %d existing", v.Uploaded, v.Existing)
+		}
+		rows = append(rows, resultRow{
+			cells: []string{v.Repo, v.Name, string(v.Action), string(v.Status), blobs},
+			err:   v.Err,
+			done:  v.Status == usecase.SyncStatusDone,
+		})
+	}
+	return rows
+}
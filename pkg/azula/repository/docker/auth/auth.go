@@ -17,6 +17,10 @@ type Config struct {
 	AuthConfigs       map[string]AuthConfig `json:"auths"`
 	CredentialsStore  string                `json:"credsStore,omitempty"`
 	CredentialHelpers map[string]string     `json:"credHelpers,omitempty"`
+
+	// path and raw are kept to save the config without losing unknown fields
+	path string
+	raw  map[string]json.RawMessage
 }
 
 // AuthConfig contains authorization information for connecting to a Registry
@@ -94,14 +98,53 @@ func LoadDefaultConfig() (Config, error) {
 
 // FromFile loads config from the specified path into cfg
 func FromFile(configPath string, cfg *Config) error {
-	f, err := os.Open(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return err
 	}
+	cfg.path = configPath
+	if err := json.Unmarshal(data, &cfg.raw); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
 
-	err = json.NewDecoder(f).Decode(&cfg)
-	f.Close()
-	return err
+// Save writes the config back to the file it was loaded from, fields unknown to Config are preserved.
+func (c *Config) Save() error {
+	if c.path == "" {
+		p, err := ConfigPath()
+		if err != nil {
+			return err
+		}
+		c.path = p
+	}
+	if c.raw == nil {
+		c.raw = map[string]json.RawMessage{}
+	}
+	known, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(known, &fields); err != nil {
+		return err
+	}
+	for _, k := range []string{"auths", "credsStore", "credHelpers"} {
+		if v, ok := fields[k]; ok {
+			c.raw[k] = v
+		} else {
+			delete(c.raw, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(c.raw, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o600)
 }
 
 // GetRegistryCredentials gets registry credentials for the passed in registry host.
@@ -177,6 +220,38 @@ func GetCredentialsFromHelper(helper, hostname string) (string, string, error) {
 	return creds.Username, creds.Secret, nil
 }
 
+// StoreCredentialsInHelper stores credentials with the `store` command of the docker credential helper.
+//
+// If the username string is empty, the secret is stored as an identity token.
+func StoreCredentialsInHelper(helper, hostname, username, secret string) error {
+	if username == "" {
+		username = tokenUsername
+	}
+	creds, err := json.Marshal(struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}{hostname, username, secret})
+	if err != nil {
+		return err
+	}
+	return runCredentialHelper(helper, "store", creds)
+}
+
+func runCredentialHelper(helper, command string, input []byte) error {
+	p, err := exec.LookPath("docker-credential-" + helper)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(p, command)
+	cmd.Stdin = strings.NewReader(string(input))
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker-credential-%s %s: %s: %w", helper, command, strings.TrimSpace(string(b)), err)
+	}
+	return nil
+}
+
 // getCredentialHelper gets the default credential helper name for the current platform.
 func getCredentialHelper() string {
 	switch runtime.GOOS {
@@ -214,6 +289,11 @@ func (c *Config) GetRegistryCredentials(hostname string) (string, string, error)
 		return GetCredentialsFromHelper("", hostname)
 	}
 
+	return authCredentials(auth)
+}
+
+// authCredentials returns credentials of an auths entry, an empty username means an identity token.
+func authCredentials(auth AuthConfig) (string, string, error) {
 	if auth.IdentityToken != "" {
 		return "", auth.IdentityToken, nil
 	}
@@ -225,6 +305,59 @@ func (c *Config) GetRegistryCredentials(hostname string) (string, string, error)
 	return DecodeBase64Auth(auth)
 }
 
+// helperFor returns the credential helper configured for the hostname, if any.
+func (c *Config) helperFor(hostname string) string {
+	if h, ok := c.CredentialHelpers[hostname]; ok {
+		return h
+	}
+	return c.CredentialsStore
+}
+
+// SetIdentityToken stores the identity token of the hostname where its credentials
+// are kept: the credential helper or the auths of the config file.
+func (c *Config) SetIdentityToken(hostname, token string) error {
+	if h := c.helperFor(hostname); h != "" {
+		return StoreCredentialsInHelper(h, hostname, "", token)
+	}
+	if c.AuthConfigs == nil {
+		c.AuthConfigs = map[string]AuthConfig{}
+	}
+	auth := c.AuthConfigs[hostname]
+	auth.IdentityToken = token
+	c.AuthConfigs[hostname] = auth
+	return c.Save()
+}
+
+// StoreCredentials stores credentials of the hostname in the credential helper configured
+// for it or in the auths of the config file, the way `docker login` does.
+func (c *Config) StoreCredentials(hostname, username, password string) error {
+	if h := c.helperFor(hostname); h != "" {
+		return StoreCredentialsInHelper(h, hostname, username, password)
+	}
+	if c.AuthConfigs == nil {
+		c.AuthConfigs = map[string]AuthConfig{}
+	}
+	c.AuthConfigs[hostname] = AuthConfig{
+		Auth: base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	return c.Save()
+}
+
+// EraseCredentials removes credentials of the hostname from the credential helper
+// configured for it and from the auths of the config file.
+func (c *Config) EraseCredentials(hostname string) error {
+	if h := c.helperFor(hostname); h != "" {
+		if err := runCredentialHelper(h, "erase", []byte(hostname)); err != nil {
+			return err
+		}
+	}
+	if _, ok := c.AuthConfigs[hostname]; !ok {
+		return nil
+	}
+	delete(c.AuthConfigs, hostname)
+	return c.Save()
+}
+
 // DecodeBase64Auth decodes the legacy file-based auth storage from the docker CLI.
 // It takes the "Auth" filed from AuthConfig and decodes that into a username and password.
 //
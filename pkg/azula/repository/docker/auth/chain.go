@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Names of the credential sources.
+const (
+	SourceEnv              = "env"
+	SourcePasswordFile     = "password-file"
+	SourceDockerConfigJSON = "dockerconfigjson"
+	SourceDocker           = "docker"
+	SourceAnonymous        = "anonymous"
+)
+
+// Source provides registry credentials.
+//
+// If the returned username string is empty, the password is an identity token.
+// Sources return ok false when they don't have credentials of the hostname.
+type Source interface {
+	Name() string
+	Get(hostname string) (username, password string, ok bool, err error)
+}
+
+// Chain looks up credentials in its sources in order, the first source having them wins.
+type Chain []Source
+
+// Get returns the credentials and the name of the source they were taken from,
+// an empty name means no source has credentials of the hostname.
+func (c Chain) Get(hostname string) (string, string, string, error) {
+	for _, s := range c {
+		user, pass, ok, err := s.Get(hostname)
+		if err != nil {
+			return "", "", "", fmt.Errorf("credentials source %s: %w", s.Name(), err)
+		}
+		if ok {
+			return user, pass, s.Name(), nil
+		}
+	}
+	return "", "", "", nil
+}
+
+// EnvSource takes credentials from AZULA_USERNAME and AZULA_PASSWORD, both are required.
+type EnvSource struct{}
+
+func (EnvSource) Name() string { return SourceEnv }
+
+func (EnvSource) Get(string) (string, string, bool, error) {
+	pass := os.Getenv("AZULA_PASSWORD")
+	if pass == "" {
+		return "", "", false, nil
+	}
+	user := os.Getenv("AZULA_USERNAME")
+	if user == "" {
+		return "", "", false, errors.New("AZULA_PASSWORD is set without AZULA_USERNAME")
+	}
+	return user, pass, true, nil
+}
+
+// PasswordFileSource reads the password from a file, e.g. a mounted secret.
+// Username and Path fall back to AZULA_USERNAME and AZULA_PASSWORD_FILE, a username is required.
+type PasswordFileSource struct {
+	Username string
+	Path     string
+}
+
+func (PasswordFileSource) Name() string { return SourcePasswordFile }
+
+func (s PasswordFileSource) Get(string) (string, string, bool, error) {
+	p, user := s.Path, s.Username
+	if p == "" {
+		p = os.Getenv("AZULA_PASSWORD_FILE")
+	}
+	if user == "" {
+		user = os.Getenv("AZULA_USERNAME")
+	}
+	if p == "" {
+		return "", "", false, nil
+	}
+	// an empty username would make the password an identity token
+	if user == "" {
+		return "", "", false, errors.New("password file is set without a username, set AZULA_USERNAME")
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", "", false, err
+	}
+	return user, strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// DockerConfigJSONSource reads the auths of a mounted kubernetes.io/dockerconfigjson secret,
+// credential helpers of the file are ignored. Path falls back to AZULA_DOCKERCONFIGJSON.
+type DockerConfigJSONSource struct {
+	Path string
+}
+
+func (DockerConfigJSONSource) Name() string { return SourceDockerConfigJSON }
+
+func (s DockerConfigJSONSource) Get(hostname string) (string, string, bool, error) {
+	p := s.Path
+	if p == "" {
+		p = os.Getenv("AZULA_DOCKERCONFIGJSON")
+	}
+	if p == "" {
+		return "", "", false, nil
+	}
+	var cfg Config
+	if err := FromFile(p, &cfg); err != nil {
+		return "", "", false, err
+	}
+	auth, ok := cfg.AuthConfigs[hostname]
+	if !ok {
+		return "", "", false, nil
+	}
+	user, pass, err := authCredentials(auth)
+	return user, pass, err == nil && pass != "", err
+}
+
+// DockerSource uses the docker cli config and its credential helpers,
+// the default helper of the platform is used if the config doesn't exist.
+type DockerSource struct{}
+
+func (DockerSource) Name() string { return SourceDocker }
+
+func (DockerSource) Get(hostname string) (string, string, bool, error) {
+	user, pass, err := GetRegistryCredentials(hostname)
+	return user, pass, err == nil && pass != "", err
+}
+
+// AnonymousSource stops the chain without credentials.
+type AnonymousSource struct{}
+
+func (AnonymousSource) Name() string { return SourceAnonymous }
+
+func (AnonymousSource) Get(string) (string, string, bool, error) {
+	return "", "", true, nil
+}
+
+// LoadDefaultConfigIfExists is LoadDefaultConfig returning an empty config when the file doesn't exist.
+func LoadDefaultConfigIfExists() (Config, error) {
+	cfg, err := LoadDefaultConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+	return cfg, err
+}
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nikgalkin/azula/pkg/azula/repository/docker/registry"
 
@@ -24,21 +25,43 @@ type Registry struct {
 }
 
 type RegistryInit struct {
-	Username string
-	Password string
-	URL      string
+	Username      string
+	Password      string
+	IdentityToken string
+	URL           string
+	TLS           registry.TLSOptions
+	Retry         registry.RetryOptions
+	// Timeout limits waiting for response headers of a single attempt.
+	Timeout time.Duration
+	// RateLimit is the max number of requests per second to a host.
+	RateLimit float64
+	// CredentialSource names the source the credentials were taken from.
+	CredentialSource string
+	// OnRefreshToken is called when a token server issues a new refresh token.
+	OnRefreshToken func(token string)
 }
 
 type Manager interface {
 	ListReposLike(context.Context, string, int) ([]string, error)
 	GetRepo(context.Context, string) (distribution.Repository, error)
 	GetV2Descriptor(context.Context, string, string) (distribution.Descriptor, error)
+	GetPlatforms(context.Context, string, distribution.Descriptor) ([]PlatformManifest, error)
+	DeleteTag(context.Context, string, string) error
+	UploadBlob(context.Context, string, distribution.Descriptor, io.ReaderAt, int64) error
 }
 
+// ErrTagDeleteUnsupported is returned when a registry can delete manifests by digest only.
+var ErrTagDeleteUnsupported = errors.New("registry doesn't support deleting tags")
+
 func (init *RegistryInit) New() (Manager, error) {
 	dr := Registry{}
 	var err error
-	dr.Transport, err = registry.NewTrans(init.Username, init.Password, init.URL)
+	dr.Transport, err = registry.NewTrans(init.URL, registry.Credentials{
+		Username:       init.Username,
+		Password:       init.Password,
+		IdentityToken:  init.IdentityToken,
+		OnRefreshToken: init.OnRefreshToken,
+	}, init.options())
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +73,39 @@ func (init *RegistryInit) New() (Manager, error) {
 	return &dr, nil
 }
 
+func (init *RegistryInit) options() registry.Options {
+	return registry.Options{TLS: init.TLS, Retry: init.Retry, Timeout: init.Timeout, RateLimit: init.RateLimit}
+}
+
+// Verify checks the credentials with an authorized request to the API base of the registry.
+func (init *RegistryInit) Verify(ctx context.Context) error {
+	trans, err := registry.NewTrans(init.URL, registry.Credentials{
+		Username:      init.Username,
+		Password:      init.Password,
+		IdentityToken: init.IdentityToken,
+	}, init.options())
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(init.URL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.JoinPath("v2").String()+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := trans.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry %s rejected credentials: %w", u.Host, parseError(resp, nil))
+	}
+	return nil
+}
+
 func (r *Registry) ListReposLike(ctx context.Context, like string, max_entries int) ([]string, error) {
 	step := 50
 	if max_entries < step {
@@ -65,7 +121,7 @@ func (r *Registry) ListReposLike(ctx context.Context, like string, max_entries i
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return []string{}, err
+			return []string{}, FromError(err)
 		}
 		if len(result) >= max_entries {
 			fmt.Printf(
@@ -106,12 +162,13 @@ func (r *Registry) GetV2Descriptor(ctx context.Context, name, tag string) (distr
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
-	mediaType := "application/vnd.docker.distribution.manifest.v2+json"
-	req, err := http.NewRequest(http.MethodHead, u.JoinPath("v2", name, "manifests", tag).String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.JoinPath("v2", name, "manifests", tag).String(), nil)
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
-	req.Header.Add("Accept", mediaType)
+	for _, mediaType := range ManifestMediaTypes {
+		req.Header.Add("Accept", mediaType)
+	}
 
 	resp, err := r.Transport.RoundTrip(req)
 	if err != nil {
@@ -123,7 +180,43 @@ func (r *Registry) GetV2Descriptor(ctx context.Context, name, tag string) (distr
 		return descriptorFromResponse(resp)
 	}
 
-	return distribution.Descriptor{}, fmt.Errorf("can't retrive description for %s:%s", name, tag)
+	return distribution.Descriptor{}, fmt.Errorf("%s:%s: %w", name, tag, parseError(resp, ErrManifestUnknown))
+}
+
+// DeleteTag removes only the tag with the distribution-spec tag deletion endpoint,
+// the manifest and other tags pointing at it stay untouched.
+func (r *Registry) DeleteTag(ctx context.Context, name, tag string) error {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.JoinPath("v2", name, "manifests", tag).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// distribution with deletes disabled answers 405 UNSUPPORTED to any delete
+		if e := readError(resp); e != nil && errors.Is(e, ErrUnsupported) {
+			return fmt.Errorf("can't delete tag %s:%s: %w", name, tag, e)
+		}
+		return ErrTagDeleteUnsupported
+	}
+	err = parseError(resp, ErrManifestUnknown)
+	// distribution answers 400 DIGEST_INVALID as it treats the reference as a digest
+	if resp.StatusCode == http.StatusBadRequest && (errors.Is(err, ErrDigestInvalid) || errors.Is(err, ErrUnsupported)) {
+		return ErrTagDeleteUnsupported
+	}
+	return fmt.Errorf("can't delete tag %s:%s: %w", name, tag, err)
 }
 
 func descriptorFromResponse(response *http.Response) (distribution.Descriptor, error) {
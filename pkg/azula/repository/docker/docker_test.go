@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestManager returns a manager of a registry answering calls other than
+// the API base with handle.
+func newTestManager(t *testing.T, handle http.HandlerFunc) Manager {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	init := RegistryInit{URL: srv.URL}
+	reg, err := init.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// writeError answers with the distribution error JSON of the code, if it's not empty.
+func writeError(w http.ResponseWriter, status int, code string) {
+	if len(code) < 1 {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q,"message":"message of %s"}]}`, code, code)
+}
+
+func TestDeleteTag(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		code   string
+		// want is nil if the tag is deleted
+		want error
+		// not is an error which must not match
+		not error
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "ok", status: http.StatusOK},
+		{name: "method not allowed", status: http.StatusMethodNotAllowed, want: ErrTagDeleteUnsupported, not: ErrUnsupported},
+		{name: "not implemented", status: http.StatusNotImplemented, want: ErrTagDeleteUnsupported},
+		{name: "deletes disabled", status: http.StatusMethodNotAllowed, code: "UNSUPPORTED", want: ErrUnsupported, not: ErrTagDeleteUnsupported},
+		{name: "reference taken as a digest", status: http.StatusBadRequest, code: "DIGEST_INVALID", want: ErrTagDeleteUnsupported},
+		{name: "unsupported request", status: http.StatusBadRequest, code: "UNSUPPORTED", want: ErrTagDeleteUnsupported},
+		{name: "invalid tag", status: http.StatusBadRequest, code: "TAG_INVALID", want: ErrTagInvalid, not: ErrTagDeleteUnsupported},
+		{name: "unknown tag", status: http.StatusNotFound, want: ErrManifestUnknown},
+		{name: "unknown repository", status: http.StatusNotFound, code: "NAME_UNKNOWN", want: ErrNameUnknown},
+		{name: "denied", status: http.StatusForbidden, code: "DENIED", want: ErrDenied},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete || r.URL.Path != "/v2/team/app/manifests/v1" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				writeError(w, tc.status, tc.code)
+			})
+			err := reg.DeleteTag(context.Background(), "team/app", "v1")
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("error %v, want %v", err, tc.want)
+			}
+			if tc.not != nil && errors.Is(err, tc.not) {
+				t.Errorf("error %v matches %v", err, tc.not)
+			}
+		})
+	}
+}
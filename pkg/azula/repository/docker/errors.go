@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+)
+
+// Error is an error of the registry API, see the error codes of the distribution spec.
+// Errors match the ones with the same code with errors.Is.
+type Error struct {
+	Code       string
+	Message    string
+	Detail     interface{}
+	StatusCode int
+}
+
+// Errors of the registry API by code.
+var (
+	ErrBlobUnknown       = &Error{Code: "BLOB_UNKNOWN"}
+	ErrManifestUnknown   = &Error{Code: "MANIFEST_UNKNOWN"}
+	ErrNameUnknown       = &Error{Code: "NAME_UNKNOWN"}
+	ErrUnsupported       = &Error{Code: "UNSUPPORTED"}
+	ErrUnauthorized      = &Error{Code: "UNAUTHORIZED"}
+	ErrDenied            = &Error{Code: "DENIED"}
+	ErrTooManyRequests   = &Error{Code: "TOOMANYREQUESTS"}
+	ErrDigestInvalid     = &Error{Code: "DIGEST_INVALID"}
+	ErrManifestInvalid   = &Error{Code: "MANIFEST_INVALID"}
+	ErrNameInvalid       = &Error{Code: "NAME_INVALID"}
+	ErrTagInvalid        = &Error{Code: "TAG_INVALID"}
+	ErrBlobUploadUnknown = &Error{Code: "BLOB_UPLOAD_UNKNOWN"}
+)
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(msg) < 1 {
+		msg = strings.ToLower(strings.ReplaceAll(e.Code, "_", " "))
+	}
+	return e.Code + ": " + msg
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// parseError reads the distribution error JSON of the response. Responses without
+// a body, e.g. to HEAD, get the code of the status, notFound is used for 404.
+func parseError(resp *http.Response, notFound *Error) error {
+	if e := readError(resp); e != nil {
+		return e
+	}
+	if code := statusCode(resp.StatusCode, notFound); code != nil {
+		return &Error{Code: code.Code, StatusCode: resp.StatusCode}
+	}
+	return fmt.Errorf("unexpected status: %s", resp.Status)
+}
+
+// readError returns the first error of the distribution error JSON of the response,
+// nil if the body has none.
+func readError(resp *http.Response) *Error {
+	var body struct {
+		Errors []struct {
+			Code    string      `json:"code"`
+			Message string      `json:"message"`
+			Detail  interface{} `json:"detail"`
+		} `json:"errors"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &body); err != nil || len(body.Errors) < 1 || len(body.Errors[0].Code) < 1 {
+		return nil
+	}
+	e := body.Errors[0]
+	return &Error{Code: e.Code, Message: e.Message, Detail: e.Detail, StatusCode: resp.StatusCode}
+}
+
+func statusCode(status int, notFound *Error) *Error {
+	switch status {
+	case http.StatusNotFound:
+		return notFound
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrDenied
+	case http.StatusMethodNotAllowed:
+		return ErrUnsupported
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	}
+	return nil
+}
+
+// FromError converts errors of the distribution client to *Error keeping the
+// message of err, other errors are returned as is.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	code := clientErrorCode(err)
+	if code == nil {
+		return err
+	}
+	res := *code
+	// keep the context of wrapped client errors
+	if len(res.Message) < 1 || errors.Unwrap(err) != nil {
+		res.Message = err.Error()
+	}
+	var unexpected *client.UnexpectedHTTPResponseError
+	if errors.As(err, &unexpected) {
+		res.StatusCode = unexpected.StatusCode
+	}
+	return &res
+}
+
+// clientErrorCode finds the registry error of a distribution client error,
+// the message is set if the client error carries one of the registry.
+func clientErrorCode(err error) *Error {
+	var unknown distribution.ErrManifestUnknown
+	var unknownRevision distribution.ErrManifestUnknownRevision
+	if errors.As(err, &unknown) || errors.As(err, &unknownRevision) {
+		return ErrManifestUnknown
+	}
+	if errors.Is(err, distribution.ErrBlobUnknown) {
+		return ErrBlobUnknown
+	}
+	var unexpected *client.UnexpectedHTTPResponseError
+	if errors.As(err, &unexpected) {
+		return statusCode(unexpected.StatusCode, nil)
+	}
+	var errs errcode.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if code := clientErrorCode(e); code != nil {
+				return code
+			}
+		}
+		return nil
+	}
+	var ee errcode.Error
+	if errors.As(err, &ee) {
+		return &Error{Code: ee.Code.String(), Message: ee.Message, Detail: ee.Detail}
+	}
+	var code errcode.ErrorCode
+	if errors.As(err, &code) {
+		return &Error{Code: code.String(), Message: code.Message()}
+	}
+	return nil
+}
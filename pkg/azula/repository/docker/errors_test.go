@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+)
+
+func TestParseError(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		want    *Error
+		message string
+	}{
+		{"body code", http.StatusBadRequest, `{"errors":[{"code":"TAG_INVALID","message":"bad tag"}]}`, ErrTagInvalid, "TAG_INVALID: bad tag"},
+		{"first of codes", http.StatusNotFound, `{"errors":[{"code":"NAME_UNKNOWN"},{"code":"MANIFEST_UNKNOWN"}]}`, ErrNameUnknown, "NAME_UNKNOWN: name unknown"},
+		{"body over status", http.StatusMethodNotAllowed, `{"errors":[{"code":"DENIED","message":"read only"}]}`, ErrDenied, "DENIED: read only"},
+		{"not found", http.StatusNotFound, "", ErrManifestUnknown, "MANIFEST_UNKNOWN: manifest unknown"},
+		{"not found without code", http.StatusNotFound, `{"errors":[{"message":"gone"}]}`, ErrManifestUnknown, "MANIFEST_UNKNOWN: manifest unknown"},
+		{"unauthorized", http.StatusUnauthorized, "", ErrUnauthorized, "UNAUTHORIZED: unauthorized"},
+		{"forbidden", http.StatusForbidden, "<html>forbidden</html>", ErrDenied, "DENIED: denied"},
+		{"method not allowed", http.StatusMethodNotAllowed, "", ErrUnsupported, "UNSUPPORTED: unsupported"},
+		{"too many requests", http.StatusTooManyRequests, "", ErrTooManyRequests, "TOOMANYREQUESTS: toomanyrequests"},
+		{"unexpected status", http.StatusInternalServerError, "oops", nil, "unexpected status: 500 Internal Server Error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tc.status,
+				Status:     fmt.Sprintf("%d %s", tc.status, http.StatusText(tc.status)),
+				Body:       io.NopCloser(strings.NewReader(tc.body)),
+			}
+			err := parseError(resp, ErrManifestUnknown)
+			if err.Error() != tc.message {
+				t.Errorf("message %q, want %q", err, tc.message)
+			}
+			var e *Error
+			if tc.want == nil {
+				if errors.As(err, &e) {
+					t.Errorf("error %v is typed", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("error %v, want %v", err, tc.want)
+			}
+			if errors.As(err, &e) && e.StatusCode != tc.status {
+				t.Errorf("status %d, want %d", e.StatusCode, tc.status)
+			}
+		})
+	}
+}
+
+func TestFromError(t *testing.T) {
+	plain := errors.New("plain")
+	for _, tc := range []struct {
+		name string
+		err  error
+		// want is nil if err is returned as is
+		want    *Error
+		message string
+	}{
+		{name: "nil"},
+		{name: "not of the client", err: plain},
+		{name: "typed", err: fmt.Errorf("wrapped: %w", ErrDenied), want: ErrDenied, message: "wrapped: DENIED: denied"},
+		{
+			name:    "manifest unknown",
+			err:     distribution.ErrManifestUnknown{Name: "app", Tag: "v1"},
+			want:    ErrManifestUnknown,
+			message: "MANIFEST_UNKNOWN: unknown manifest name=app tag=v1",
+		},
+		{
+			name:    "manifest revision unknown",
+			err:     distribution.ErrManifestUnknownRevision{Name: "app", Revision: "sha256:abc"},
+			want:    ErrManifestUnknown,
+			message: "MANIFEST_UNKNOWN: unknown manifest name=app revision=sha256:abc",
+		},
+		{name: "blob unknown", err: distribution.ErrBlobUnknown, want: ErrBlobUnknown, message: "BLOB_UNKNOWN: unknown blob"},
+		{
+			name:    "unexpected status",
+			err:     &client.UnexpectedHTTPResponseError{ParseErr: errors.New("bad json"), StatusCode: http.StatusForbidden, Response: []byte("denied")},
+			want:    ErrDenied,
+			message: "DENIED: error parsing HTTP 403 response body: bad json: \"denied\"",
+		},
+		{name: "unexpected server error", err: &client.UnexpectedHTTPResponseError{ParseErr: errors.New("bad json"), StatusCode: http.StatusBadGateway}},
+		{
+			name:    "registry errors",
+			err:     errcode.Errors{errcode.ErrorCodeUnknown.WithMessage("odd"), v2.ErrorCodeNameUnknown.WithMessage("no such repo")},
+			want:    &Error{Code: "UNKNOWN"},
+			message: "UNKNOWN: odd",
+		},
+		{
+			name:    "registry error",
+			err:     v2.ErrorCodeManifestInvalid.WithMessage("bad manifest"),
+			want:    ErrManifestInvalid,
+			message: "MANIFEST_INVALID: bad manifest",
+		},
+		{
+			name:    "wrapped registry error",
+			err:     fmt.Errorf("can't push: %w", errcode.Errors{errcode.ErrorCodeDenied.WithMessage("read only")}),
+			want:    ErrDenied,
+			message: "DENIED: can't push: denied: read only",
+		},
+		{name: "error code", err: errcode.ErrorCodeTooManyRequests, want: ErrTooManyRequests, message: "TOOMANYREQUESTS: too many requests"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := FromError(tc.err)
+			if tc.want == nil {
+				if err != tc.err {
+					t.Errorf("error %v, want %v as is", err, tc.err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("error %v, want %v", err, tc.want)
+			}
+			if err.Error() != tc.message {
+				t.Errorf("message %q, want %q", err, tc.message)
+			}
+		})
+	}
+}
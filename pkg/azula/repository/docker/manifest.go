@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	KindImage   = "image"
+	KindIndex   = "index"
+	KindUnknown = "unknown"
+)
+
+// ManifestMediaTypes are accepted while resolving descriptors, indexes go first
+// so a registry doesn't down-convert multi-arch tags to a single platform.
+var ManifestMediaTypes = []string{
+	manifestlist.MediaTypeManifestList,
+	v1.MediaTypeImageIndex,
+	schema2.MediaTypeManifest,
+	v1.MediaTypeImageManifest,
+}
+
+// ManifestKind tells whether the media type is an image manifest or an index of them.
+func ManifestKind(mediaType string) string {
+	switch mediaType {
+	case manifestlist.MediaTypeManifestList, v1.MediaTypeImageIndex:
+		return KindIndex
+	case schema2.MediaTypeManifest, v1.MediaTypeImageManifest:
+		return KindImage
+	default:
+		return KindUnknown
+	}
+}
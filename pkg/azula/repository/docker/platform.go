@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+)
+
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// PlatformManifest is an image manifest of a single platform.
+type PlatformManifest struct {
+	Platform   Platform
+	Descriptor distribution.Descriptor
+	// Size is a compressed size of the config and all the layers.
+	Size int64
+	// Created is read from the config of a single image, it's zero for index entries.
+	Created time.Time
+}
+
+func (p Platform) String() string {
+	if len(p.Variant) > 0 {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Match reports whether the platform satisfies the filter, an empty variant of the filter matches any.
+func (p Platform) Match(filter Platform) bool {
+	return p.OS == filter.OS && p.Architecture == filter.Architecture &&
+		(len(filter.Variant) < 1 || p.Variant == filter.Variant)
+}
+
+// ParsePlatform parses platforms in os/arch[/variant] format, e.g. linux/arm64/v8.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) < 1 || len(parts[1]) < 1 {
+		return Platform{}, fmt.Errorf("platform '%s' must be in os/arch[/variant] format", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// GetPlatforms returns manifests of every platform of the descriptor. For an image manifest
+// the platform is read from its config. Index entries of unknown platform, like buildx
+// attestations, are skipped.
+func (r *Registry) GetPlatforms(ctx context.Context, name string, desc distribution.Descriptor) ([]PlatformManifest, error) {
+	repo, err := r.GetRepo(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ms.Get(ctx, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	index, ok := m.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		config, size, err := imageBlobs(m)
+		if err != nil {
+			return nil, err
+		}
+		data, err := repo.Blobs(ctx).Get(ctx, config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var cfg struct {
+			Platform
+			Created time.Time `json:"created"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+		return []PlatformManifest{{Platform: cfg.Platform, Descriptor: desc, Size: size, Created: cfg.Created}}, nil
+	}
+
+	res := make([]PlatformManifest, 0, len(index.Manifests))
+	for _, v := range index.Manifests {
+		if v.Platform.OS == "unknown" {
+			continue
+		}
+		child, err := ms.Get(ctx, v.Digest)
+		if err != nil {
+			return nil, err
+		}
+		_, size, err := imageBlobs(child)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, PlatformManifest{
+			Platform: Platform{
+				OS:           v.Platform.OS,
+				Architecture: v.Platform.Architecture,
+				Variant:      v.Platform.Variant,
+			},
+			Descriptor: v.Descriptor,
+			Size:       size,
+		})
+	}
+	return res, nil
+}
+
+// imageBlobs returns the config descriptor of an image manifest and a compressed size of the image.
+func imageBlobs(m distribution.Manifest) (distribution.Descriptor, int64, error) {
+	var config distribution.Descriptor
+	var layers []distribution.Descriptor
+	switch v := m.(type) {
+	case *schema2.DeserializedManifest:
+		config, layers = v.Config, v.Layers
+	case *ocischema.DeserializedManifest:
+		config, layers = v.Config, v.Layers
+	default:
+		mediaType, _, _ := m.Payload()
+		return distribution.Descriptor{}, 0, fmt.Errorf("manifest of type '%s' is not an image", mediaType)
+	}
+	size := config.Size
+	for _, l := range layers {
+		size += l.Size
+	}
+	return config, size, nil
+}
@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimitTransport spaces requests to every host evenly, so no more than
+// the limit of requests per second are sent to a host.
+type rateLimitTransport struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newRateLimitTransport(base http.RoundTripper, perSecond float64) http.RoundTripper {
+	if perSecond <= 0 {
+		return base
+	}
+	return &rateLimitTransport{
+		base:     base,
+		interval: time.Duration(float64(time.Second) / perSecond),
+		next:     map[string]time.Time{},
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := t.reserve(req.URL.Host); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// reserve books the next free slot of the host and returns how long to wait for it.
+func (t *rateLimitTransport) reserve(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	slot := t.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[host] = slot.Add(t.interval)
+	return slot.Sub(now)
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryOptions configure retries of transient failures: network errors and 429, 502, 503, 504 statuses.
+// Zero fields take values of DefaultRetryOptions.
+type RetryOptions struct {
+	// Attempts is the max number of attempts of a request, 1 disables retries.
+	Attempts int
+	// MinBackoff and MaxBackoff bound the exponential backoff between attempts.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetryAfter caps waits requested by the Retry-After header.
+	MaxRetryAfter time.Duration
+	// NonIdempotent enables retries of POST, PATCH and DELETE requests and of blob
+	// upload commits. Their first attempt may succeed behind a failed response, then
+	// a retry fails with MANIFEST_UNKNOWN or BLOB_UPLOAD_UNKNOWN.
+	NonIdempotent bool
+}
+
+var DefaultRetryOptions = RetryOptions{
+	Attempts:      4,
+	MinBackoff:    500 * time.Millisecond,
+	MaxBackoff:    10 * time.Second,
+	MaxRetryAfter: time.Minute,
+}
+
+type retryTransport struct {
+	base http.RoundTripper
+	opts RetryOptions
+}
+
+func newRetryTransport(base http.RoundTripper, opts RetryOptions) http.RoundTripper {
+	if opts.Attempts < 1 {
+		opts.Attempts = DefaultRetryOptions.Attempts
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultRetryOptions.MinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultRetryOptions.MaxBackoff
+	}
+	if opts.MaxRetryAfter <= 0 {
+		opts.MaxRetryAfter = DefaultRetryOptions.MaxRetryAfter
+	}
+	return &retryTransport{base: base, opts: opts}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.canRetry(req) {
+		return t.base.RoundTrip(req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.opts.Attempts || !retryable(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = d
+				if wait > t.opts.MaxRetryAfter {
+					wait = t.opts.MaxRetryAfter
+				}
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		fmt.Fprintf(os.Stderr, "WARN: %s %s: %s, retrying in %s (%d/%d)\n",
+			req.Method, req.URL.Redacted(), reason, wait.Round(time.Millisecond), attempt, t.opts.Attempts-1)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// canRetry allows reads and manifest puts and, if enabled, others with a replayable body.
+func (t *retryTransport) canRetry(req *http.Request) bool {
+	if t.opts.Attempts < 2 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPut:
+		return !strings.Contains(req.URL.Path, "/blobs/uploads/") || t.opts.NonIdempotent
+	}
+	return t.opts.NonIdempotent
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the exponential backoff of the attempt with jitter in [d/2, d).
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	d := t.opts.MinBackoff << (attempt - 1)
+	if d > t.opts.MaxBackoff || d <= 0 {
+		d = t.opts.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses the Retry-After header in seconds or as an HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if len(v) < 1 {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusServer answers requests with statuses in order, the last one is repeated.
+type statusServer struct {
+	*httptest.Server
+	statuses   []int
+	retryAfter string
+
+	mu       sync.Mutex
+	requests int
+	bodies   []string
+}
+
+func newStatusServer(t *testing.T, statuses ...int) *statusServer {
+	s := &statusServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		status := s.statuses[len(s.statuses)-1]
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		if len(s.retryAfter) > 0 {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testRetryOptions() RetryOptions {
+	return RetryOptions{Attempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+}
+
+func TestRetryTransport(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		method        string
+		path          string
+		nonIdempotent bool
+		statuses      []int
+		wantStatus    int
+		wantRequests  int
+	}{
+		{"read recovers", http.MethodGet, "/v2/app/tags/list", false, []int{503, 502, 200}, 200, 3},
+		{"throttled head", http.MethodHead, "/v2/app/manifests/v1", false, []int{429, 200}, 200, 2},
+		{"attempts run out", http.MethodGet, "/v2/app/tags/list", false, []int{504}, 504, 3},
+		{"server error isn't transient", http.MethodGet, "/v2/app/tags/list", false, []int{500, 200}, 500, 1},
+		{"manifest put", http.MethodPut, "/v2/app/manifests/v1", false, []int{503, 201}, 201, 2},
+		{"blob upload commit", http.MethodPut, "/v2/app/blobs/uploads/1", false, []int{503, 201}, 503, 1},
+		{"blob upload commit enabled", http.MethodPut, "/v2/app/blobs/uploads/1", true, []int{503, 201}, 201, 2},
+		{"delete", http.MethodDelete, "/v2/app/manifests/sha256:abc", false, []int{503, 202}, 503, 1},
+		{"delete enabled", http.MethodDelete, "/v2/app/manifests/sha256:abc", true, []int{503, 202}, 202, 2},
+		{"upload start", http.MethodPost, "/v2/app/blobs/uploads/", false, []int{503, 202}, 503, 1},
+		{"chunk enabled", http.MethodPatch, "/v2/app/blobs/uploads/1", true, []int{502, 202}, 202, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStatusServer(t, tc.statuses...)
+			opts := testRetryOptions()
+			opts.NonIdempotent = tc.nonIdempotent
+			trans := newRetryTransport(http.DefaultTransport, opts)
+			req, err := http.NewRequest(tc.method, s.URL+tc.path, strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := trans.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if s.requests != tc.wantRequests {
+				t.Errorf("%d requests, want %d", s.requests, tc.wantRequests)
+			}
+			for i, body := range s.bodies {
+				if tc.method != http.MethodHead && body != "payload" {
+					t.Errorf("body of attempt %d is %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportHonoursRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		retryAfter string
+		maxWait    time.Duration
+		min, max   time.Duration
+	}{
+		{"seconds", "1", time.Minute, time.Second, 3 * time.Second},
+		{"capped", "120", 50 * time.Millisecond, 50 * time.Millisecond, time.Second},
+		// HTTP dates are in seconds, so the wait is within the last second before the date
+		{"date", "+2s", time.Minute, time.Second, 3 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStatusServer(t, 429, 200)
+			s.retryAfter = tc.retryAfter
+			if d, err := time.ParseDuration(tc.retryAfter); err == nil {
+				s.retryAfter = time.Now().Add(d).UTC().Format(http.TimeFormat)
+			}
+			opts := testRetryOptions()
+			opts.MaxRetryAfter = tc.maxWait
+			trans := newRetryTransport(http.DefaultTransport, opts)
+			req, err := http.NewRequest(http.MethodGet, s.URL+"/v2/_catalog", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := trans.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if d := time.Since(start); d < tc.min || d > tc.max {
+				t.Errorf("retried in %s, want between %s and %s", d, tc.min, tc.max)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	} {
+		got, ok := retryAfter(tc.value)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	trans := newRetryTransport(http.DefaultTransport, RetryOptions{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}).(*retryTransport)
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 40: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := trans.backoff(attempt); d < max/2 || d > max {
+				t.Errorf("backoff of attempt %d is %s, want between %s and %s", attempt, d, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCertsDir is the docker dir with per registry certificates.
+const DefaultCertsDir = "/etc/docker/certs.d"
+
+type TLSOptions struct {
+	// CAFile and CADir are PEM encoded CA certificates trusted along with the system ones.
+	CAFile string
+	CADir  string
+	// CertFile and KeyFile are the client certificate for mTLS.
+	CertFile string
+	KeyFile  string
+	// CertsDir follows the docker certs.d layout: <CertsDir>/<host>/ contains *.crt CA
+	// certificates and *.cert/*.key client certificate pairs.
+	CertsDir           string
+	InsecureSkipVerify bool
+}
+
+// newBaseTransport returns the default transport with TLS configured for the host.
+func newBaseTransport(host string, opts TLSOptions) (*http.Transport, error) {
+	cfg, err := newTLSConfig(host, opts)
+	if err != nil {
+		return nil, err
+	}
+	trans := http.DefaultTransport.(*http.Transport).Clone()
+	trans.TLSClientConfig = cfg
+	return trans, nil
+}
+
+func newTLSConfig(host string, opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	caFiles := []string{}
+	if len(opts.CAFile) > 0 {
+		caFiles = append(caFiles, opts.CAFile)
+	}
+	if len(opts.CADir) > 0 {
+		files, err := filesWithExt(opts.CADir, ".crt", ".pem")
+		if err != nil {
+			return nil, err
+		}
+		caFiles = append(caFiles, files...)
+	}
+	if len(opts.CertFile) > 0 || len(opts.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %w", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	certsDir := opts.CertsDir
+	if len(certsDir) < 1 {
+		certsDir = DefaultCertsDir
+	}
+	hostDir := filepath.Join(certsDir, host)
+	if _, err := os.Stat(hostDir); err == nil {
+		files, err := filesWithExt(hostDir, ".crt")
+		if err != nil {
+			return nil, err
+		}
+		caFiles = append(caFiles, files...)
+		certs, err := filesWithExt(hostDir, ".cert")
+		if err != nil {
+			return nil, err
+		}
+		for _, certFile := range certs {
+			keyFile := strings.TrimSuffix(certFile, ".cert") + ".key"
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("can't load client certificate of %s: %w", hostDir, err)
+			}
+			cfg.Certificates = append(cfg.Certificates, cert)
+		}
+	}
+
+	for _, f := range caFiles {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", f)
+		}
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+func filesWithExt(dir string, exts ...string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(e.Name(), ext) {
+				res = append(res, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,243 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+)
+
+// minTokenLifetime is the token lifetime when a token server doesn't tell it, see
+// https://docs.docker.com/registry/spec/auth/token/#token-response-fields
+const minTokenLifetime = 60 * time.Second
+
+// expirationLeeway refreshes tokens a bit earlier to not send an expired one.
+const expirationLeeway = 5 * time.Second
+
+// clientID identifies azula to token servers in the OAuth2 flow.
+const clientID = "azula"
+
+var repoPathRe = regexp.MustCompile(`/v2/(.+?)/(manifests|blobs|tags)/`)
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenFetch is a token request in flight, requests of the same scopes wait for it.
+type tokenFetch struct {
+	done  chan struct{}
+	token cachedToken
+	err   error
+}
+
+// tokenHandler requests bearer tokens scoped to the request and caches them per scope
+// until they expire.
+type tokenHandler struct {
+	transport http.RoundTripper
+	creds     auth.CredentialStore
+
+	mu      sync.Mutex
+	tokens  map[string]cachedToken
+	fetches map[string]*tokenFetch
+}
+
+type tokenResponse struct {
+	Token        string    `json:"token"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in"`
+	IssuedAt     time.Time `json:"issued_at"`
+}
+
+func newTokenHandler(transport http.RoundTripper, creds auth.CredentialStore) auth.AuthenticationHandler {
+	return &tokenHandler{
+		transport: transport,
+		creds:     creds,
+		tokens:    map[string]cachedToken{},
+		fetches:   map[string]*tokenFetch{},
+	}
+}
+
+func (th *tokenHandler) Scheme() string {
+	return "bearer"
+}
+
+func (th *tokenHandler) AuthorizeRequest(req *http.Request, params map[string]string) error {
+	token, err := th.getToken(params, requestScopes(req))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// getToken returns the cached token of the scopes or fetches it. The lock isn't held
+// while fetching, so tokens of other scopes are fetched at the same time, and
+// concurrent requests of the same scopes share a single fetch.
+func (th *tokenHandler) getToken(params map[string]string, scopes []string) (string, error) {
+	key := params["realm"] + " " + strings.Join(scopes, " ")
+
+	th.mu.Lock()
+	if t, ok := th.tokens[key]; ok && time.Now().Add(expirationLeeway).Before(t.expires) {
+		th.mu.Unlock()
+		return t.token, nil
+	}
+	if f, ok := th.fetches[key]; ok {
+		th.mu.Unlock()
+		<-f.done
+		return f.token.token, f.err
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	th.fetches[key] = f
+	th.mu.Unlock()
+
+	f.token, f.err = th.fetchToken(params, scopes)
+	th.mu.Lock()
+	delete(th.fetches, key)
+	if f.err == nil {
+		th.tokens[key] = f.token
+	}
+	th.mu.Unlock()
+	close(f.done)
+	return f.token.token, f.err
+}
+
+func (th *tokenHandler) fetchToken(params map[string]string, scopes []string) (cachedToken, error) {
+	realm, ok := params["realm"]
+	if !ok {
+		return cachedToken{}, errors.New("no realm specified for token auth challenge")
+	}
+	realmURL, err := url.Parse(realm)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("invalid token auth challenge realm: %w", err)
+	}
+	service := params["service"]
+
+	if refreshToken := th.creds.RefreshToken(realmURL, service); len(refreshToken) > 0 {
+		return th.fetchTokenWithOAuth(realmURL, service, refreshToken, scopes)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, realmURL.String(), nil)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	query := req.URL.Query()
+	if len(service) > 0 {
+		query.Add("service", service)
+	}
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+	if username, password := th.creds.Basic(realmURL); len(username) > 0 && len(password) > 0 {
+		query.Add("account", username)
+		req.SetBasicAuth(username, password)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := th.transport.RoundTrip(req)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	defer resp.Body.Close()
+	if !client.SuccessStatus(resp.StatusCode) {
+		return cachedToken{}, client.HandleErrorResponse(resp)
+	}
+
+	tr := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return cachedToken{}, fmt.Errorf("unable to decode token response: %w", err)
+	}
+	if len(tr.RefreshToken) > 0 {
+		th.creds.SetRefreshToken(realmURL, service, tr.RefreshToken)
+	}
+	return tr.cached()
+}
+
+// fetchTokenWithOAuth exchanges the refresh token for an access token with the OAuth2
+// refresh_token grant. A rotated refresh token is kept for the next requests.
+func (th *tokenHandler) fetchTokenWithOAuth(realm *url.URL, service, refreshToken string, scopes []string) (cachedToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("service", service)
+	form.Set("client_id", clientID)
+	form.Set("scope", strings.Join(scopes, " "))
+
+	req, err := http.NewRequest(http.MethodPost, realm.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return cachedToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := th.transport.RoundTrip(req)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	defer resp.Body.Close()
+	if !client.SuccessStatus(resp.StatusCode) {
+		return cachedToken{}, client.HandleErrorResponse(resp)
+	}
+
+	tr := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return cachedToken{}, fmt.Errorf("unable to decode token response: %w", err)
+	}
+	if len(tr.RefreshToken) > 0 && tr.RefreshToken != refreshToken {
+		th.creds.SetRefreshToken(realm, service, tr.RefreshToken)
+	}
+	return tr.cached()
+}
+
+func (tr tokenResponse) cached() (cachedToken, error) {
+	// access_token is equivalent to token
+	if len(tr.AccessToken) > 0 {
+		tr.Token = tr.AccessToken
+	}
+	if len(tr.Token) < 1 {
+		return cachedToken{}, auth.ErrNoToken
+	}
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime < minTokenLifetime {
+		lifetime = minTokenLifetime
+	}
+	if tr.IssuedAt.IsZero() {
+		tr.IssuedAt = time.Now()
+	}
+	return cachedToken{token: tr.Token, expires: tr.IssuedAt.Add(lifetime)}, nil
+}
+
+// requestScopes returns the scopes required by the request to the registry API:
+// catalog listing needs registry:catalog:*, repository requests need pull action to read,
+// pull and delete to delete or pull and push to write. Read-only accounts get no more
+// than pull from strict token servers, so reads don't ask for more. Cross repository
+// blob mounts need pull action on the source repository too.
+func requestScopes(req *http.Request) []string {
+	if strings.HasSuffix(req.URL.Path, "/v2/_catalog") {
+		return []string{"registry:catalog:*"}
+	}
+	m := repoPathRe.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		return nil
+	}
+	actions := "pull"
+	switch req.Method {
+	case http.MethodDelete:
+		actions = "pull,delete"
+	case http.MethodPut, http.MethodPost, http.MethodPatch:
+		actions = "pull,push"
+	}
+	scopes := []string{fmt.Sprintf("repository:%s:%s", m[1], actions)}
+	if from := req.URL.Query().Get("from"); len(from) > 0 {
+		scopes = append(scopes, fmt.Sprintf("repository:%s:pull", from))
+	}
+	return scopes
+}
@@ -0,0 +1,249 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues tokens named after the scopes and the number of the fetch.
+type tokenServer struct {
+	*httptest.Server
+	fetches int32
+	// lifetime and age set expires_in and issued_at of responses, if not zero
+	lifetime time.Duration
+	age      time.Duration
+	// handle is called before the token is issued
+	handle func(r *http.Request)
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&ts.fetches, 1)
+		ts.mu.Lock()
+		ts.requests = append(ts.requests, r)
+		ts.mu.Unlock()
+		if ts.handle != nil {
+			ts.handle(r)
+		}
+		resp := tokenResponse{Token: fmt.Sprintf("%s#%d", strings.Join(r.URL.Query()["scope"], " "), n)}
+		if ts.lifetime > 0 {
+			resp.ExpiresIn = int(ts.lifetime.Seconds())
+			resp.IssuedAt = time.Now().Add(-ts.age)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) params() map[string]string {
+	return map[string]string{"realm": ts.URL + "/token", "service": "registry.test"}
+}
+
+func (ts *tokenServer) count() int32 {
+	return atomic.LoadInt32(&ts.fetches)
+}
+
+func (ts *tokenServer) lastRequest() *http.Request {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.requests[len(ts.requests)-1]
+}
+
+func newTestTokenHandler(store *regCredentialStore) *tokenHandler {
+	if store.refreshTokens == nil {
+		store.refreshTokens = map[string]string{}
+	}
+	return newTokenHandler(http.DefaultTransport, store).(*tokenHandler)
+}
+
+func TestRequestScopes(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodGet, "/v2/_catalog?n=50", []string{"registry:catalog:*"}},
+		{http.MethodGet, "/v2/team/app/tags/list", []string{"repository:team/app:pull"}},
+		{http.MethodHead, "/v2/app/manifests/v1", []string{"repository:app:pull"}},
+		{http.MethodGet, "/v2/app/blobs/sha256:abc", []string{"repository:app:pull"}},
+		{http.MethodDelete, "/v2/app/manifests/sha256:abc", []string{"repository:app:pull,delete"}},
+		{http.MethodPut, "/v2/app/manifests/v1", []string{"repository:app:pull,push"}},
+		{http.MethodPatch, "/v2/app/blobs/uploads/123", []string{"repository:app:pull,push"}},
+		{http.MethodPost, "/v2/app/blobs/uploads/?mount=sha256:abc&from=team/base", []string{"repository:app:pull,push", "repository:team/base:pull"}},
+		{http.MethodGet, "/v2/", nil},
+	} {
+		req := httptest.NewRequest(tc.method, "https://registry.test"+tc.path, nil)
+		if got := requestScopes(req); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %s: scopes %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestTokenCachedPerScope(t *testing.T) {
+	ts := newTokenServer(t)
+	th := newTestTokenHandler(&regCredentialStore{})
+	pull := []string{"repository:app:pull"}
+	push := []string{"repository:app:pull,push"}
+
+	first, err := th.getToken(ts.params(), pull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := th.getToken(ts.params(), pull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("token of the same scope is %s, want cached %s", again, first)
+	}
+	other, err := th.getToken(ts.params(), push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Errorf("token of another scope is the cached %s", other)
+	}
+	if n := ts.count(); n != 2 {
+		t.Errorf("%d tokens fetched, want 2", n)
+	}
+}
+
+func TestTokenRefetchedAfterExpiry(t *testing.T) {
+	scopes := []string{"repository:app:pull"}
+	for _, tc := range []struct {
+		name    string
+		age     time.Duration
+		fetches int32
+	}{
+		{"valid", 200 * time.Second, 1},
+		// expires in 2s, which is within the leeway
+		{"expired", 298 * time.Second, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTokenServer(t)
+			ts.lifetime, ts.age = 300*time.Second, tc.age
+			th := newTestTokenHandler(&regCredentialStore{})
+			for i := 0; i < 2; i++ {
+				if _, err := th.getToken(ts.params(), scopes); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := ts.count(); n != tc.fetches {
+				t.Errorf("%d tokens fetched, want %d", n, tc.fetches)
+			}
+		})
+	}
+}
+
+func TestTokenFetchCredentials(t *testing.T) {
+	scopes := []string{"repository:app:pull"}
+
+	t.Run("anonymous", func(t *testing.T) {
+		ts := newTokenServer(t)
+		if _, err := newTestTokenHandler(&regCredentialStore{}).getToken(ts.params(), scopes); err != nil {
+			t.Fatal(err)
+		}
+		req := ts.lastRequest()
+		if auth := req.Header.Get("Authorization"); len(auth) > 0 {
+			t.Errorf("anonymous request has Authorization %q", auth)
+		}
+		q := req.URL.Query()
+		if q.Has("account") {
+			t.Errorf("anonymous request has account %q", q.Get("account"))
+		}
+		if q.Get("service") != "registry.test" || q.Get("scope") != scopes[0] {
+			t.Errorf("unexpected query %s", req.URL.RawQuery)
+		}
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		ts := newTokenServer(t)
+		th := newTestTokenHandler(&regCredentialStore{username: "robot", password: "secret"})
+		if _, err := th.getToken(ts.params(), scopes); err != nil {
+			t.Fatal(err)
+		}
+		req := ts.lastRequest()
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "robot" || pass != "secret" {
+			t.Errorf("basic auth is %q:%q (%t), want robot:secret", user, pass, ok)
+		}
+		if account := req.URL.Query().Get("account"); account != "robot" {
+			t.Errorf("account is %q, want robot", account)
+		}
+	})
+}
+
+func TestTokenFetchesDontBlockOtherScopes(t *testing.T) {
+	ts := newTokenServer(t)
+	both := make(chan struct{})
+	var arrived int32
+	ts.handle = func(r *http.Request) {
+		if atomic.AddInt32(&arrived, 1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+		case <-time.After(5 * time.Second):
+			t.Error("token of another scope wasn't requested while fetching")
+		}
+	}
+	th := newTestTokenHandler(&regCredentialStore{})
+
+	var wg sync.WaitGroup
+	for _, repo := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(repo string) {
+			defer wg.Done()
+			if _, err := th.getToken(ts.params(), []string{"repository:" + repo + ":pull"}); err != nil {
+				t.Error(err)
+			}
+		}(repo)
+	}
+	wg.Wait()
+}
+
+func TestTokenFetchSharedBySameScope(t *testing.T) {
+	ts := newTokenServer(t)
+	release := make(chan struct{})
+	ts.handle = func(r *http.Request) { <-release }
+	th := newTestTokenHandler(&regCredentialStore{})
+	scopes := []string{"repository:app:pull"}
+
+	tokens := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if tokens[i], err = th.getToken(ts.params(), scopes); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := ts.count(); n != 1 {
+		t.Errorf("%d tokens fetched, want 1", n)
+	}
+	for _, v := range tokens[1:] {
+		if v != tokens[0] {
+			t.Errorf("tokens %q differ", tokens)
+			break
+		}
+	}
+}
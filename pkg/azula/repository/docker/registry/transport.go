@@ -3,27 +3,76 @@ package registry
 import (
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/docker/distribution/registry/client/transport"
 )
 
+// Credentials to access a registry. IdentityToken replaces username and password,
+// it's used as a refresh token to request access tokens with OAuth2.
+type Credentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+	// OnRefreshToken is called when a token server issues a new refresh token.
+	OnRefreshToken func(token string)
+}
+
 type regCredentialStore struct {
-	username      string
-	password      string
+	username       string
+	password       string
+	identityToken  string
+	onRefreshToken func(string)
+
+	mu            sync.Mutex
 	refreshTokens map[string]string
+
+	// persistMu serializes onRefreshToken calls, persisted is the last token passed to it
+	persistMu sync.Mutex
+	persisted map[string]string
 }
 
-func NewTrans(user, pass, url string) (http.RoundTripper, error) {
-	creds := &regCredentialStore{username: user, password: pass}
+type Options struct {
+	TLS   TLSOptions
+	Retry RetryOptions
+	// Timeout limits waiting for response headers of a single attempt, no limit if zero.
+	Timeout time.Duration
+	// RateLimit is the max number of requests per second to a host, no limit if zero.
+	RateLimit float64
+}
+
+func NewTrans(registryURL string, creds Credentials, opts Options) (http.RoundTripper, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, err
+	}
+	baseTrans, err := newBaseTransport(u.Host, opts.TLS)
+	if err != nil {
+		return nil, err
+	}
+	baseTrans.ResponseHeaderTimeout = opts.Timeout
+	base := newRetryTransport(newRateLimitTransport(baseTrans, opts.RateLimit), opts.Retry)
+	store := &regCredentialStore{
+		username:       creds.Username,
+		password:       creds.Password,
+		identityToken:  creds.IdentityToken,
+		onRefreshToken: creds.OnRefreshToken,
+		refreshTokens:  map[string]string{},
+		persisted:      map[string]string{},
+	}
 	challengeManager := challenge.NewSimpleManager()
-	_, err := ping(challengeManager, url+"/v2/", "")
+	_, err = ping(base, challengeManager, registryURL+"/v2/", "")
 	if err != nil {
 		return nil, err
 	}
 	trans := transport.NewTransport(
-		nil, auth.NewAuthorizer(challengeManager, auth.NewBasicHandler(creds)),
+		base, auth.NewAuthorizer(challengeManager,
+			auth.NewBasicHandler(store),
+			newTokenHandler(base, store),
+		),
 	)
 	return trans, nil
 }
@@ -32,18 +81,45 @@ func (tcs *regCredentialStore) Basic(*url.URL) (string, string) {
 	return tcs.username, tcs.password
 }
 
+// RefreshToken returns the refresh token issued for the service during the session,
+// the identity token is the initial one.
 func (tcs *regCredentialStore) RefreshToken(u *url.URL, service string) string {
-	return tcs.refreshTokens[service]
+	tcs.mu.Lock()
+	defer tcs.mu.Unlock()
+	if token, ok := tcs.refreshTokens[service]; ok {
+		return token
+	}
+	return tcs.identityToken
 }
 
 func (tcs *regCredentialStore) SetRefreshToken(u *url.URL, service string, token string) {
-	if tcs.refreshTokens != nil {
-		tcs.refreshTokens[service] = token
+	tcs.mu.Lock()
+	tcs.refreshTokens[service] = token
+	tcs.mu.Unlock()
+	tcs.persist(service)
+}
+
+// persist passes the current refresh token of the service to onRefreshToken. Calls
+// are serialized, so workers don't rewrite the credential store at the same time,
+// and a token is passed once, even if it was set by several workers.
+func (tcs *regCredentialStore) persist(service string) {
+	if tcs.onRefreshToken == nil {
+		return
+	}
+	tcs.persistMu.Lock()
+	defer tcs.persistMu.Unlock()
+	tcs.mu.Lock()
+	token := tcs.refreshTokens[service]
+	tcs.mu.Unlock()
+	if tcs.persisted[service] == token {
+		return
 	}
+	tcs.persisted[service] = token
+	tcs.onRefreshToken(token)
 }
 
-func ping(manager challenge.Manager, endpoint, versionHeader string) ([]auth.APIVersion, error) {
-	resp, err := http.Get(endpoint)
+func ping(base http.RoundTripper, manager challenge.Manager, endpoint, versionHeader string) ([]auth.APIVersion, error) {
+	resp, err := (&http.Client{Transport: base}).Get(endpoint)
 	if err != nil {
 		return nil, err
 	}
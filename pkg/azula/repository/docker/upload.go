@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/docker/distribution"
+)
+
+// DefaultChunkSize is the size of PATCH requests of chunked uploads.
+const DefaultChunkSize = 16 << 20
+
+// chunkAttempts limits attempts to upload a chunk, the retry transport doesn't
+// retry PATCH requests as they aren't idempotent.
+const chunkAttempts = 4
+
+// errUploadRangeAmbiguous is returned for the 0-0 range, which registries report
+// both for an empty upload and for an upload of a single byte.
+var errUploadRangeAmbiguous = errors.New("upload range 0-0 is either empty or a single byte")
+
+// UploadBlob pushes the blob in chunks of chunkSize. When a chunk fails, the
+// registry is asked how much of the blob it has and the upload goes on from
+// there, an upload the registry has forgotten or holding at most a byte is started
+// over. The registry checks the digest of desc when the upload is committed.
+func (r *Registry) UploadBlob(ctx context.Context, name string, desc distribution.Descriptor, content io.ReaderAt, chunkSize int64) error {
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+	location, err := r.startUpload(ctx, name)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	failures := 0
+	for offset < desc.Size {
+		n := chunkSize
+		if desc.Size-offset < n {
+			n = desc.Size - offset
+		}
+		next, err := r.uploadChunk(ctx, location, io.NewSectionReader(content, offset, n), offset, n)
+		if err == nil {
+			location, offset, failures = next, offset+n, 0
+			continue
+		}
+		failures++
+		if ctx.Err() != nil || failures >= chunkAttempts {
+			return fmt.Errorf("can't upload blob %s: %w", desc.Digest, err)
+		}
+		next, end, statusErr := r.uploadStatus(ctx, location)
+		switch {
+		case errors.Is(statusErr, ErrBlobUploadUnknown), errors.Is(statusErr, errUploadRangeAmbiguous):
+			fmt.Fprintf(os.Stderr, "WARN: upload of %s can't be resumed (%v: %v), starting over\n", desc.Digest, err, statusErr)
+			if location, err = r.startUpload(ctx, name); err != nil {
+				return err
+			}
+			offset = 0
+		case statusErr != nil:
+			return fmt.Errorf("can't upload blob %s: %w", desc.Digest, err)
+		default:
+			fmt.Fprintf(os.Stderr, "WARN: chunk of %s failed (%v), resuming at %d of %d bytes\n", desc.Digest, err, end, desc.Size)
+			location, offset = next, end
+		}
+	}
+	err = r.commitUpload(ctx, location, desc)
+	if err != nil && r.blobExists(ctx, name, desc) {
+		// the commit isn't retried, the registry may have taken it behind a failed response
+		return nil
+	}
+	return err
+}
+
+func (r *Registry) startUpload(ctx context.Context, name string) (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.JoinPath("v2", name, "blobs", "uploads").String()+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("can't start upload to %s: %w", name, parseError(resp, ErrNameUnknown))
+	}
+	return uploadLocation(req, resp)
+}
+
+// uploadChunk sends n bytes at offset and returns the location of the next chunk.
+func (r *Registry) uploadChunk(ctx context.Context, location string, chunk io.Reader, offset, n int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, location, chunk)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+n-1))
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", parseError(resp, ErrBlobUploadUnknown)
+	}
+	return uploadLocation(req, resp)
+}
+
+// uploadStatus asks the registry how much of the upload it has.
+func (r *Registry) uploadStatus(ctx context.Context, location string) (string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return "", 0, parseError(resp, ErrBlobUploadUnknown)
+	}
+	return uploadProgress(req, resp)
+}
+
+func (r *Registry) commitUpload(ctx context.Context, location string, desc distribution.Descriptor) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("digest", desc.Digest.String())
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("can't commit blob %s: %w", desc.Digest, parseError(resp, ErrBlobUploadUnknown))
+	}
+	return nil
+}
+
+// blobExists tells whether the registry has the blob, errors count as missing.
+func (r *Registry) blobExists(ctx context.Context, name string, desc distribution.Descriptor) bool {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.JoinPath("v2", name, "blobs", desc.Digest.String()).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// uploadProgress reads the location and the Range header of an upload status,
+// an upload without the header is empty. Registries answer 0-0 both for an empty
+// upload and after the first byte, so errUploadRangeAmbiguous is returned for it:
+// resuming at either offset may be refused or corrupt the blob.
+func uploadProgress(req *http.Request, resp *http.Response) (string, int64, error) {
+	location, err := uploadLocation(req, resp)
+	if err != nil {
+		return "", 0, err
+	}
+	rng := resp.Header.Get("Range")
+	if len(rng) < 1 {
+		return location, 0, nil
+	}
+	var start, end int64
+	if n, err := fmt.Sscanf(rng, "%d-%d", &start, &end); err != nil || n != 2 || end < start {
+		return "", 0, fmt.Errorf("bad range of upload: '%s'", rng)
+	}
+	if end == 0 {
+		return "", 0, errUploadRangeAmbiguous
+	}
+	return location, end + 1, nil
+}
+
+// uploadLocation resolves the Location header, which may be relative to the request.
+func uploadLocation(req *http.Request, resp *http.Response) (string, error) {
+	location := resp.Header.Get("Location")
+	if len(location) < 1 {
+		return req.URL.String(), nil
+	}
+	u, err := req.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,166 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+// patchFailure makes a PATCH fail after the registry kept some bytes of the chunk.
+type patchFailure struct {
+	keep int
+	// lose forgets the upload
+	lose bool
+}
+
+// uploadServer is a registry taking chunked uploads of the app repository,
+// it refuses chunks not starting at the end of the upload like the spec requires.
+type uploadServer struct {
+	// failures by the number of the PATCH request, from 1
+	failures map[int]patchFailure
+	// noRange omits the Range header of empty uploads
+	noRange bool
+	// commitFailure answers 500 to commits taken by the registry
+	commitFailure bool
+
+	mu      sync.Mutex
+	uploads map[string][]byte
+	blobs   map[digest.Digest]bool
+	starts  int
+	patches int
+}
+
+func (s *uploadServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	const uploads = "/v2/app/blobs/uploads/"
+	if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/app/blobs/") {
+		if !s.blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, "/v2/app/blobs/"))] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, uploads) {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, uploads)
+	if r.Method == http.MethodPost {
+		s.starts++
+		id = fmt.Sprint(s.starts)
+		s.uploads[id] = []byte{}
+		w.Header().Set("Location", uploads+id)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN")
+		return
+	}
+	switch r.Method {
+	case http.MethodPatch:
+		s.patches++
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &end); err != nil || start != len(data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		chunk, _ := io.ReadAll(r.Body)
+		if f, ok := s.failures[s.patches]; ok {
+			s.uploads[id] = append(data, chunk[:f.keep]...)
+			if f.lose {
+				delete(s.uploads, id)
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.uploads[id] = append(data, chunk...)
+		w.Header().Set("Location", uploads+id)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodGet:
+		// the range of an empty upload is 0-0 like distribution answers
+		end := len(data) - 1
+		if end < 0 {
+			end = 0
+		}
+		if len(data) > 0 || !s.noRange {
+			w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+		}
+		w.Header().Set("Location", uploads+id)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if digest.FromBytes(data) != dgst {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID")
+			return
+		}
+		s.blobs[dgst] = true
+		delete(s.uploads, id)
+		if s.commitFailure {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestUploadBlobResumes(t *testing.T) {
+	data := []byte("0123456789")
+	desc := distribution.Descriptor{Digest: digest.FromBytes(data), Size: int64(len(data))}
+	for _, tc := range []struct {
+		name     string
+		failures map[int]patchFailure
+		noRange  bool
+		// starts is the number of uploads started, zero if the upload fails
+		starts int
+	}{
+		{name: "no failures", starts: 1},
+		{name: "chunk kept partly", failures: map[int]patchFailure{2: {keep: 2}}, starts: 1},
+		{name: "chunk not kept", failures: map[int]patchFailure{2: {}}, starts: 1},
+		{name: "last chunk kept partly", failures: map[int]patchFailure{3: {keep: 1}}, starts: 1},
+		{name: "first byte kept", failures: map[int]patchFailure{1: {keep: 1}}, starts: 2},
+		{name: "nothing kept", failures: map[int]patchFailure{1: {}}, starts: 2},
+		{name: "nothing kept without range", failures: map[int]patchFailure{1: {}}, noRange: true, starts: 1},
+		{name: "upload lost", failures: map[int]patchFailure{2: {keep: 1, lose: true}}, starts: 2},
+		{name: "failures in a row", failures: map[int]patchFailure{2: {}, 3: {}, 4: {}, 5: {}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &uploadServer{failures: tc.failures, noRange: tc.noRange, uploads: map[string][]byte{}, blobs: map[digest.Digest]bool{}}
+			reg := newTestManager(t, s.handle)
+			err := reg.UploadBlob(context.Background(), "app", desc, strings.NewReader(string(data)), 4)
+			if tc.starts == 0 {
+				if err == nil {
+					t.Fatal("upload succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.blobs[desc.Digest] {
+				t.Error("blob isn't committed")
+			}
+			if s.starts != tc.starts {
+				t.Errorf("%d uploads started, want %d", s.starts, tc.starts)
+			}
+		})
+	}
+}
+
+func TestUploadBlobCommitTakenBehindFailure(t *testing.T) {
+	data := []byte("0123456789")
+	desc := distribution.Descriptor{Digest: digest.FromBytes(data), Size: int64(len(data))}
+	s := &uploadServer{commitFailure: true, uploads: map[string][]byte{}, blobs: map[digest.Digest]bool{}}
+	reg := newTestManager(t, s.handle)
+	if err := reg.UploadBlob(context.Background(), "app", desc, strings.NewReader(string(data)), 4); err != nil {
+		t.Fatalf("commit taken by the registry failed: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker/auth"
+)
+
+type AuthUsecase interface {
+	Login(ctx context.Context, username, password string) error
+	Logout(ctx context.Context) error
+	WhoAmI(ctx context.Context) (Identity, error)
+}
+
+// Identity describes credentials used to access the registry.
+type Identity struct {
+	Registry string `json:"registry" yaml:"registry"`
+	// Source is the credential source, empty if no source has credentials of the registry.
+	Source        string `json:"source" yaml:"source"`
+	Username      string `json:"username,omitempty" yaml:"username,omitempty"`
+	IdentityToken bool   `json:"identityToken" yaml:"identityToken"`
+	Anonymous     bool   `json:"anonymous" yaml:"anonymous"`
+}
+
+// CredentialsResolver returns the settings of the registry with the credentials
+// of the credential chain.
+type CredentialsResolver func() (docker.RegistryInit, error)
+
+type authUsecase struct {
+	Registry docker.RegistryInit
+	resolve  CredentialsResolver
+}
+
+// NewAuth manages credentials of the registry in the docker cli config. The init
+// has no credentials, so a broken credential source doesn't stop login and logout,
+// credentials are resolved by WhoAmI only.
+func NewAuth(init docker.RegistryInit, resolve CredentialsResolver) AuthUsecase {
+	return &authUsecase{Registry: init, resolve: resolve}
+}
+
+// Login verifies the credentials against the registry and stores them
+// in the credential helper or in the docker cli config.
+func (u *authUsecase) Login(ctx context.Context, username, password string) error {
+	host, err := u.host()
+	if err != nil {
+		return err
+	}
+	init := u.Registry
+	init.Username, init.Password, init.IdentityToken, init.OnRefreshToken = username, password, "", nil
+	if err := init.Verify(ctx); err != nil {
+		return err
+	}
+	cfg, err := auth.LoadDefaultConfigIfExists()
+	if err != nil {
+		return err
+	}
+	return cfg.StoreCredentials(host, username, password)
+}
+
+// Logout removes credentials of the registry from the credential helper and the docker cli config.
+func (u *authUsecase) Logout(ctx context.Context) error {
+	host, err := u.host()
+	if err != nil {
+		return err
+	}
+	cfg, err := auth.LoadDefaultConfigIfExists()
+	if err != nil {
+		return err
+	}
+	return cfg.EraseCredentials(host)
+}
+
+// WhoAmI describes the resolved credentials, the error tells whether the registry accepts them.
+func (u *authUsecase) WhoAmI(ctx context.Context) (Identity, error) {
+	host, err := u.host()
+	if err != nil {
+		return Identity{}, err
+	}
+	init, err := u.resolve()
+	if err != nil {
+		return Identity{Registry: host}, err
+	}
+	id := Identity{
+		Registry:      host,
+		Source:        init.CredentialSource,
+		Username:      init.Username,
+		IdentityToken: len(init.IdentityToken) > 0,
+	}
+	id.Anonymous = len(id.Username) < 1 && !id.IdentityToken
+	init.OnRefreshToken = nil
+	return id, init.Verify(ctx)
+}
+
+func (u *authUsecase) host() (string, error) {
+	r, err := url.Parse(u.Registry.URL)
+	if err != nil {
+		return "", err
+	}
+	return r.Host, nil
+}
@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/opencontainers/go-digest"
+)
+
+type CopyOptions struct {
+	// Overwrite moves the destination tag, if it points at another manifest.
+	Overwrite bool
+}
+
+// CopyResult tells how the content got to the destination repository.
+type CopyResult struct {
+	Src    Tag           `json:"src" yaml:"src"`
+	Dst    Tag           `json:"dst" yaml:"dst"`
+	Digest digest.Digest `json:"digest" yaml:"digest"`
+	// Unchanged is set when the destination already pointed at the manifest.
+	Unchanged bool `json:"unchanged" yaml:"unchanged"`
+	// Blobs existing in the destination, mounted from the source repository or uploaded.
+	Existing int64 `json:"existing" yaml:"existing"`
+	Mounted  int64 `json:"mounted" yaml:"mounted"`
+	Uploaded int64 `json:"uploaded" yaml:"uploaded"`
+}
+
+// Copy points dst at the manifest of src. Within a repository the manifest is only
+// put under the new tag. Across repositories blobs are mounted from the source
+// repository first, or uploaded if the registry refuses to mount them, and manifests
+// of an index are put by digest before the index.
+func (u *usecase) Copy(ctx context.Context, src, dst Tag, opts CopyOptions) (CopyResult, error) {
+	res := CopyResult{Src: src, Dst: dst}
+	srcRepo, err := u.Registry.GetRepo(ctx, src.Repo)
+	if err != nil {
+		return res, err
+	}
+	desc, err := u.Registry.GetV2Descriptor(ctx, src.Repo, src.Name)
+	if err != nil {
+		return res, err
+	}
+	res.Digest = desc.Digest
+
+	current, err := u.Registry.GetV2Descriptor(ctx, dst.Repo, dst.Name)
+	switch {
+	case err == nil && current.Digest == desc.Digest:
+		res.Unchanged = true
+		return res, nil
+	case err == nil && !opts.Overwrite:
+		return res, fmt.Errorf("%s already points at %s, overwrite is required to move it", dst, current.Digest)
+	case err != nil && !errors.Is(err, docker.ErrManifestUnknown) && !errors.Is(err, docker.ErrNameUnknown):
+		return res, err
+	}
+
+	dstRepo, err := u.Registry.GetRepo(ctx, dst.Repo)
+	if err != nil {
+		return res, err
+	}
+	m, err := getManifest(ctx, srcRepo, desc.Digest)
+	if err != nil {
+		return res, err
+	}
+	if src.Repo != dst.Repo {
+		if err := copyContent(ctx, u.limit, srcRepo, dstRepo, m, true, &res); err != nil {
+			return res, fmt.Errorf("can't copy %s to %s: %w", src, dst, err)
+		}
+	}
+	return res, putManifest(ctx, dstRepo, m, dst, desc.Digest)
+}
+
+// putManifest puts the manifest under the tag and verifies the digest the registry computed.
+func putManifest(ctx context.Context, r distribution.Repository, m distribution.Manifest, tag Tag, expected digest.Digest) error {
+	ms, err := r.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	dgst, err := ms.Put(ctx, m, distribution.WithTag(tag.Name))
+	if err != nil {
+		return fmt.Errorf("can't put manifest %s: %w", tag, err)
+	}
+	if dgst != expected {
+		return fmt.Errorf("digest of %s is %s, expected %s", tag, dgst, expected)
+	}
+	return nil
+}
+
+// copyContent makes blobs of the manifest and manifests of an index available in dst,
+// blobs are copied within the limit of calls l. Blobs are mounted only if mount is set,
+// i.e. both repositories are in the same registry.
+func copyContent(ctx context.Context, l limiter, src, dst distribution.Repository, m distribution.Manifest, mount bool, res *CopyResult) error {
+	if index, ok := m.(*manifestlist.DeserializedManifestList); ok {
+		srcManifests, err := src.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		dstManifests, err := dst.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range index.Manifests {
+			if ok, err := dstManifests.Exists(ctx, v.Digest); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+			child, err := srcManifests.Get(ctx, v.Digest)
+			if err != nil {
+				return err
+			}
+			if err := copyContent(ctx, l, src, dst, child, mount, res); err != nil {
+				return err
+			}
+			if _, err := dstManifests.Put(ctx, child); err != nil {
+				return fmt.Errorf("can't put manifest %s: %w", v.Digest, err)
+			}
+		}
+		return nil
+	}
+
+	config, layers, err := getManifestBlobs(m)
+	if err != nil {
+		return err
+	}
+	blobs := append([]distribution.Descriptor{config}, layers...)
+	return parallel(ctx, l, len(blobs), func(ctx context.Context, i int) error {
+		return copyBlob(ctx, src, dst, blobs[i], mount, res)
+	})
+}
+
+// copyBlob mounts the blob from src into dst, if the registry doesn't mount it, the blob is streamed.
+func copyBlob(ctx context.Context, src, dst distribution.Repository, desc distribution.Descriptor, mount bool, res *CopyResult) error {
+	if _, err := dst.Blobs(ctx).Stat(ctx, desc.Digest); err == nil {
+		atomic.AddInt64(&res.Existing, 1)
+		return nil
+	} else if !errors.Is(err, distribution.ErrBlobUnknown) {
+		return err
+	}
+
+	options := []distribution.BlobCreateOption{}
+	if mount {
+		ref, err := reference.WithDigest(src.Named(), desc.Digest)
+		if err != nil {
+			return err
+		}
+		options = append(options, client.WithMountFrom(ref))
+	}
+	w, err := dst.Blobs(ctx).Create(ctx, options...)
+	var mounted distribution.ErrBlobMounted
+	if errors.As(err, &mounted) {
+		atomic.AddInt64(&res.Mounted, 1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := uploadBlob(ctx, src, w, desc); err != nil {
+		_ = w.Cancel(ctx)
+		return fmt.Errorf("can't upload blob %s: %w", desc.Digest, err)
+	}
+	atomic.AddInt64(&res.Uploaded, 1)
+	return nil
+}
+
+func uploadBlob(ctx context.Context, src distribution.Repository, w distribution.BlobWriter, desc distribution.Descriptor) error {
+	r, err := src.Blobs(ctx).Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	_, err = w.Commit(ctx, desc)
+	return err
+}
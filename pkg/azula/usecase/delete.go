@@ -0,0 +1,301 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+// DeletePlan describes a manifest that is going to be deleted with all tags pointing at it.
+type DeletePlan struct {
+	Repo      string        `json:"repo" yaml:"repo"`
+	Digest    digest.Digest `json:"digest" yaml:"digest"`
+	MediaType string        `json:"mediaType" yaml:"mediaType"`
+	Kind      string        `json:"kind" yaml:"kind"`
+	Tags      []string      `json:"tags" yaml:"tags"`
+	Siblings  []string      `json:"siblings,omitempty" yaml:"siblings,omitempty"`
+}
+
+type DeleteOptions struct {
+	// Force deletes the manifest by digest, even if it takes away sibling tags.
+	Force bool
+	// ContinueOnError goes through all the items reporting failures in the results,
+	// otherwise the first failure cancels the items left.
+	ContinueOnError bool
+}
+
+type DeleteStatus string
+
+const (
+	DeleteStatusDeleted      DeleteStatus = "deleted"
+	DeleteStatusNotFound     DeleteStatus = "not found"
+	DeleteStatusUnsupported  DeleteStatus = "unsupported"
+	DeleteStatusUnauthorized DeleteStatus = "unauthorized"
+	DeleteStatusFailed       DeleteStatus = "failed"
+	// DeleteStatusSkipped items were not attempted after a failure of another item.
+	DeleteStatusSkipped DeleteStatus = "skipped"
+)
+
+// DeleteResult is the outcome of deleting a manifest or the tags of a plan.
+type DeleteResult struct {
+	Repo   string        `json:"repo" yaml:"repo"`
+	Tags   []string      `json:"tags" yaml:"tags"`
+	Digest digest.Digest `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Status DeleteStatus  `json:"status" yaml:"status"`
+	Err    error         `json:"-" yaml:"-"`
+}
+
+// PlanDelete resolves the references to the manifests to delete, but deletes
+// nothing. Siblings of every plan are the tags sharing the digest which were
+// not requested. With ContinueOnError references which can't be resolved are
+// returned as failed results instead of the error.
+func (u *usecase) PlanDelete(ctx context.Context, refs []Tag, opts DeleteOptions) ([]DeletePlan, []DeleteResult, error) {
+	return u.planDelete(ctx, refs, opts)
+}
+
+// DeleteImageByTag plans and applies the deletion, results of both steps are returned.
+func (u *usecase) DeleteImageByTag(ctx context.Context, refs []Tag, opts DeleteOptions) ([]DeleteResult, error) {
+	plan, failed, err := u.planDelete(ctx, refs, opts)
+	if err != nil {
+		return failed, err
+	}
+	res, err := u.ApplyDeletePlan(ctx, plan, opts)
+	return append(failed, res...), err
+}
+
+// ApplyDeletePlan deletes manifests by digest. If a manifest has siblings, only the
+// requested tags are deleted, as long as the registry supports it. Otherwise,
+// the manifest is deleted only with Force set.
+//
+// A result is returned for every plan. Without ContinueOnError the error of the
+// first failed plan is returned too, plans which were not attempted are skipped.
+// Deletes already started when another one fails are finished, so their results
+// are known.
+func (u *usecase) ApplyDeletePlan(ctx context.Context, plan []DeletePlan, opts DeleteOptions) ([]DeleteResult, error) {
+	res := make([]DeleteResult, len(plan))
+	for i, p := range plan {
+		res[i] = DeleteResult{Repo: p.Repo, Tags: p.Tags, Digest: p.Digest, Status: DeleteStatusSkipped}
+	}
+	err := parallel(ctx, u.limit, len(plan), func(poolCtx context.Context, i int) error {
+		if poolCtx.Err() != nil {
+			return poolCtx.Err()
+		}
+		// the context of the pool is cancelled by failures of other plans
+		err := u.applyDelete(ctx, plan[i], opts)
+		res[i].Status, res[i].Err = deleteStatus(err), docker.FromError(err)
+		if opts.ContinueOnError {
+			return nil
+		}
+		return err
+	})
+	return res, err
+}
+
+func (u *usecase) applyDelete(ctx context.Context, p DeletePlan, opts DeleteOptions) error {
+	if len(p.Siblings) > 0 {
+		err := u.deleteTags(ctx, p)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, docker.ErrTagDeleteUnsupported) {
+			return err
+		}
+		if !opts.Force {
+			return fmt.Errorf("%s:%s shares digest %s with %s and %w, force is required to delete all of them",
+				p.Repo, strings.Join(p.Tags, ","), p.Digest, strings.Join(p.Siblings, ","), err)
+		}
+	}
+	r, err := u.Registry.GetRepo(ctx, p.Repo)
+	if err != nil {
+		return err
+	}
+	m, err := r.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	return m.Delete(ctx, p.Digest)
+}
+
+// deleteStatus classifies the error of a delete call.
+func deleteStatus(err error) DeleteStatus {
+	err = docker.FromError(err)
+	switch {
+	case err == nil:
+		return DeleteStatusDeleted
+	case errors.Is(err, docker.ErrTagDeleteUnsupported), errors.Is(err, docker.ErrUnsupported):
+		return DeleteStatusUnsupported
+	case errors.Is(err, docker.ErrManifestUnknown), errors.Is(err, docker.ErrNameUnknown), errors.Is(err, docker.ErrBlobUnknown):
+		return DeleteStatusNotFound
+	case errors.Is(err, docker.ErrUnauthorized), errors.Is(err, docker.ErrDenied):
+		return DeleteStatusUnauthorized
+	}
+	return DeleteStatusFailed
+}
+
+func (u *usecase) deleteTags(ctx context.Context, p DeletePlan) error {
+	for _, tag := range p.Tags {
+		if err := u.Registry.DeleteTag(ctx, p.Repo, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *usecase) planDelete(ctx context.Context, refs []Tag, opts DeleteOptions) ([]DeletePlan, []DeleteResult, error) {
+	failed := []DeleteResult{}
+
+	descs := make([]distribution.Descriptor, len(refs))
+	errs := make([]error, len(refs))
+	err := parallel(ctx, u.limit, len(refs), func(ctx context.Context, i int) error {
+		_, err := u.Registry.GetRepo(ctx, refs[i].Repo)
+		if err == nil {
+			descs[i], err = u.Registry.GetV2Descriptor(ctx, refs[i].Repo, refs[i].Name)
+		}
+		if opts.ContinueOnError {
+			errs[i] = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := make([]DeletePlan, 0, len(refs))
+	index := map[string]int{}
+	requested := map[string]bool{}
+	for i, ref := range refs {
+		if errs[i] != nil {
+			failed = append(failed, DeleteResult{Repo: ref.Repo, Tags: []string{ref.Name}, Status: deleteStatus(errs[i]), Err: docker.FromError(errs[i])})
+			continue
+		}
+		desc := descs[i]
+		requested[ref.Repo+":"+ref.Name] = true
+		key := ref.Repo + "@" + desc.Digest.String()
+		if i, ok := index[key]; ok {
+			res[i].Tags = append(res[i].Tags, ref.Name)
+			continue
+		}
+		index[key] = len(res)
+		res = append(res, DeletePlan{
+			Repo:      ref.Repo,
+			Digest:    desc.Digest,
+			MediaType: desc.MediaType,
+			Kind:      docker.ManifestKind(desc.MediaType),
+			Tags:      []string{ref.Name},
+		})
+	}
+
+	repos := []string{}
+	byRepo := map[string]map[digest.Digest][]string{}
+	repoErrs := map[string]error{}
+	for _, p := range res {
+		if _, ok := byRepo[p.Repo]; !ok {
+			byRepo[p.Repo] = nil
+			repos = append(repos, p.Repo)
+		}
+	}
+	for _, repo := range repos {
+		digests, err := u.tagsByDigest(ctx, repo)
+		if err != nil {
+			if !opts.ContinueOnError {
+				return nil, nil, err
+			}
+			repoErrs[repo] = err
+			continue
+		}
+		byRepo[repo] = digests
+	}
+	plan := res[:0]
+	for _, p := range res {
+		if err, ok := repoErrs[p.Repo]; ok {
+			failed = append(failed, DeleteResult{Repo: p.Repo, Tags: p.Tags, Digest: p.Digest, Status: deleteStatus(err), Err: docker.FromError(err)})
+			continue
+		}
+		for _, tag := range byRepo[p.Repo][p.Digest] {
+			if !requested[p.Repo+":"+tag] {
+				p.Siblings = append(p.Siblings, tag)
+			}
+		}
+		plan = append(plan, p)
+	}
+	return plan, failed, nil
+}
+
+// EstimateReclaimable sums sizes of blobs referenced only by the manifests going away
+// with the plan. Blobs used by other manifests of the same repository are not counted,
+// but the ones shared with other repositories are, so it's an upper bound of what the
+// registry garbage collection frees.
+func (u *usecase) EstimateReclaimable(ctx context.Context, plan []DeletePlan, opts DeleteOptions) (int64, error) {
+	removed := map[string]map[digest.Digest]bool{}
+	for _, p := range plan {
+		if len(p.Siblings) > 0 && !opts.Force {
+			continue
+		}
+		if removed[p.Repo] == nil {
+			removed[p.Repo] = map[digest.Digest]bool{}
+		}
+		removed[p.Repo][p.Digest] = true
+	}
+
+	var res int64
+	for repo, digests := range removed {
+		r, err := u.Registry.GetRepo(ctx, repo)
+		if err != nil {
+			return 0, err
+		}
+		all, err := u.tagsByDigest(ctx, repo)
+		if err != nil {
+			return 0, err
+		}
+		freed := map[digest.Digest]int64{}
+		kept := map[digest.Digest]int64{}
+		for dgst := range all {
+			into := kept
+			if digests[dgst] {
+				into = freed
+			}
+			if err := collectBlobs(ctx, r, dgst, into); err != nil {
+				return 0, err
+			}
+		}
+		for dgst, size := range freed {
+			if _, ok := kept[dgst]; !ok {
+				res += size
+			}
+		}
+	}
+	return res, nil
+}
+
+// tagsByDigest groups all tags of the repo by the digest they point at.
+func (u *usecase) tagsByDigest(ctx context.Context, repo string) (map[digest.Digest][]string, error) {
+	r, err := u.Registry.GetRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.Tags(ctx).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	descs := make([]distribution.Descriptor, len(tags))
+	err = parallel(ctx, u.limit, len(tags), func(ctx context.Context, i int) error {
+		var err error
+		descs[i], err = u.Registry.GetV2Descriptor(ctx, repo, tags[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[digest.Digest][]string, len(tags))
+	for i, tag := range tags {
+		res[descs[i].Digest] = append(res[descs[i].Digest], tag)
+	}
+	return res, nil
+}
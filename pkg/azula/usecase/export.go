@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type ExportFormat string
+
+const (
+	// ExportFormatOCI is a tarball of the OCI image layout
+	// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+	ExportFormatOCI ExportFormat = "oci"
+	// ExportFormatDockerArchive is a tarball `docker load` takes, it holds a single
+	// platform of every image.
+	ExportFormatDockerArchive ExportFormat = "docker-archive"
+)
+
+// annotationImageName keeps the full name of the image, the ref name annotation
+// is only the tag. The annotation is the one containerd uses.
+const annotationImageName = "io.containerd.image.name"
+
+type ExportOptions struct {
+	Format ExportFormat
+	// Platform picks the manifest of indexes, all the platforms are exported to the
+	// OCI layout if it is empty. A docker archive holds linux/amd64 by default.
+	Platform string
+}
+
+type ExportResult struct {
+	Images int   `json:"images" yaml:"images"`
+	Blobs  int   `json:"blobs" yaml:"blobs"`
+	Size   int64 `json:"size" yaml:"size"`
+}
+
+// dockerArchiveManifest is an entry of manifest.json of `docker save`.
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Export writes the images of refs as a tar archive of the format to w. Blobs are
+// streamed from the registry and verified against their digests, every blob is
+// written once, even if it is shared by several images.
+func (u *usecase) Export(ctx context.Context, refs []Tag, w io.Writer, opts ExportOptions) (ExportResult, error) {
+	if opts.Format != ExportFormatOCI && opts.Format != ExportFormatDockerArchive {
+		return ExportResult{}, fmt.Errorf("unknown export format '%s'", opts.Format)
+	}
+	filter, err := parsePlatformFilter(opts.Platform)
+	if err != nil {
+		return ExportResult{}, err
+	}
+	a := &archiveWriter{tw: tar.NewWriter(w), written: map[digest.Digest]bool{}}
+	index := v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: v1.MediaTypeImageIndex}
+	images := make([]dockerArchiveManifest, 0, len(refs))
+
+	for _, ref := range refs {
+		r, err := u.Registry.GetRepo(ctx, ref.Repo)
+		if err != nil {
+			return a.res, err
+		}
+		desc, err := u.Registry.GetV2Descriptor(ctx, ref.Repo, ref.Name)
+		if err != nil {
+			return a.res, err
+		}
+		m, err := getManifest(ctx, r, desc.Digest)
+		if err != nil {
+			return a.res, err
+		}
+		if filter != nil || opts.Format == ExportFormatDockerArchive {
+			var platformDigest digest.Digest
+			m, platformDigest, err = resolveIndex(ctx, r, m, filter)
+			if err != nil {
+				return a.res, fmt.Errorf("%s: %w", ref, err)
+			}
+			if len(platformDigest) > 0 {
+				mediaType, payload, _ := m.Payload()
+				desc = distribution.Descriptor{MediaType: mediaType, Digest: platformDigest, Size: int64(len(payload))}
+			}
+		}
+
+		if opts.Format == ExportFormatDockerArchive {
+			image, err := a.writeDockerImage(ctx, r, m)
+			if err != nil {
+				return a.res, fmt.Errorf("can't export %s: %w", ref, err)
+			}
+			image.RepoTags = []string{ref.String()}
+			images = append(images, image)
+		} else {
+			if err := a.writeImage(ctx, r, desc.Digest, m); err != nil {
+				return a.res, fmt.Errorf("can't export %s: %w", ref, err)
+			}
+			index.Manifests = append(index.Manifests, v1.Descriptor{
+				MediaType: desc.MediaType,
+				Digest:    desc.Digest,
+				Size:      desc.Size,
+				Annotations: map[string]string{
+					v1.AnnotationRefName: ref.Name,
+					annotationImageName:  ref.String(),
+				},
+			})
+		}
+		a.res.Images++
+	}
+
+	if opts.Format == ExportFormatDockerArchive {
+		if err := a.writeJSON("manifest.json", images); err != nil {
+			return a.res, err
+		}
+	} else {
+		if err := a.writeJSON(v1.ImageLayoutFile, v1.ImageLayout{Version: v1.ImageLayoutVersion}); err != nil {
+			return a.res, err
+		}
+		if err := a.writeJSON("index.json", index); err != nil {
+			return a.res, err
+		}
+	}
+	return a.res, a.tw.Close()
+}
+
+type archiveWriter struct {
+	tw      *tar.Writer
+	written map[digest.Digest]bool
+	res     ExportResult
+}
+
+// writeImage writes the manifest with its blobs, manifests of an index are written too.
+func (a *archiveWriter) writeImage(ctx context.Context, r distribution.Repository, dgst digest.Digest, m distribution.Manifest) error {
+	if a.written[dgst] {
+		return nil
+	}
+	if index, ok := m.(*manifestlist.DeserializedManifestList); ok {
+		for _, v := range index.Manifests {
+			child, err := getManifest(ctx, r, v.Digest)
+			if err != nil {
+				return err
+			}
+			if err := a.writeImage(ctx, r, v.Digest, child); err != nil {
+				return err
+			}
+		}
+	} else {
+		config, layers, err := getManifestBlobs(m)
+		if err != nil {
+			return err
+		}
+		for _, desc := range append([]distribution.Descriptor{config}, layers...) {
+			if err := a.writeBlob(ctx, r, desc); err != nil {
+				return err
+			}
+		}
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		return err
+	}
+	if actual := dgst.Algorithm().FromBytes(payload); actual != dgst {
+		return fmt.Errorf("manifest digest is %s, expected %s", actual, dgst)
+	}
+	a.written[dgst] = true
+	return a.writeFile(blobPath(dgst), payload)
+}
+
+// writeDockerImage writes blobs of the image manifest and returns its manifest.json entry.
+func (a *archiveWriter) writeDockerImage(ctx context.Context, r distribution.Repository, m distribution.Manifest) (dockerArchiveManifest, error) {
+	res := dockerArchiveManifest{}
+	config, layers, err := getManifestBlobs(m)
+	if err != nil {
+		return res, err
+	}
+	if err := a.writeBlob(ctx, r, config); err != nil {
+		return res, err
+	}
+	res.Config = blobPath(config.Digest)
+	for _, l := range layers {
+		if err := a.writeBlob(ctx, r, l); err != nil {
+			return res, err
+		}
+		res.Layers = append(res.Layers, blobPath(l.Digest))
+	}
+	return res, nil
+}
+
+// writeBlob streams the blob into the archive, the digest is checked once the
+// blob is written, so the archive must be dropped on errors.
+func (a *archiveWriter) writeBlob(ctx context.Context, r distribution.Repository, desc distribution.Descriptor) error {
+	if a.written[desc.Digest] {
+		return nil
+	}
+	blob, err := r.Blobs(ctx).Open(ctx, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("can't open blob %s: %w", desc.Digest, err)
+	}
+	defer blob.Close()
+
+	if err := a.tw.WriteHeader(fileHeader(blobPath(desc.Digest), desc.Size)); err != nil {
+		return err
+	}
+	verifier := desc.Digest.Verifier()
+	if _, err := io.Copy(a.tw, io.TeeReader(blob, verifier)); err != nil {
+		return fmt.Errorf("can't read blob %s: %w", desc.Digest, err)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("blob %s doesn't match its digest", desc.Digest)
+	}
+	a.written[desc.Digest] = true
+	a.res.Blobs++
+	a.res.Size += desc.Size
+	return nil
+}
+
+func (a *archiveWriter) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return a.writeFile(name, data)
+}
+
+func (a *archiveWriter) writeFile(name string, data []byte) error {
+	if err := a.tw.WriteHeader(fileHeader(name, int64(len(data)))); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(data)
+	return err
+}
+
+func fileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	}
+}
+
+// blobPath is the path of the blob in the OCI layout, docker archives keep blobs
+// there too, the way `docker save` of docker 25 does.
+func blobPath(dgst digest.Digest) string {
+	return path.Join("blobs", dgst.Algorithm().String(), dgst.Encoded())
+}
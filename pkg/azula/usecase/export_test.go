@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// readTestArchive returns the files of the tar archive by name.
+func readTestArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := files[h.Name]; ok {
+			t.Errorf("%s is written twice", h.Name)
+		}
+		if files[h.Name], err = io.ReadAll(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// tamperBlob changes the first byte of the blob served by the registry.
+func tamperBlob(h http.Handler, dgst digest.Digest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		if len(body) > 0 {
+			body[0] ^= 0xff
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(body)
+	})
+}
+
+func TestExport(t *testing.T) {
+	reg := newTestRegistry(t)
+	app := Tag{Repo: "app", Name: "v1"}
+	web := Tag{Repo: "web", Name: "v1"}
+	appDigest := pushTestImage(t, reg, app, "app", "base", "app")
+	webDigest := pushTestImage(t, reg, web, "web", "base", "web")
+
+	for _, tc := range []struct {
+		format ExportFormat
+		// files are the ones besides blobs
+		files []string
+		// blobs are configs and layers, and manifests in the OCI layout
+		blobs int
+	}{
+		{ExportFormatOCI, []string{v1.ImageLayoutFile, "index.json"}, 7},
+		{ExportFormatDockerArchive, []string{"manifest.json"}, 5},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			u := New(reg, Options{})
+			var buf bytes.Buffer
+			res, err := u.Export(context.Background(), []Tag{app, web}, &buf, ExportOptions{Format: tc.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Images != 2 || res.Blobs != 5 {
+				t.Errorf("exported %d images of %d blobs, want 2 of 5", res.Images, res.Blobs)
+			}
+			files := readTestArchive(t, buf.Bytes())
+			if len(files) != len(tc.files)+tc.blobs {
+				t.Errorf("%d files, want %d", len(files), len(tc.files)+tc.blobs)
+			}
+			for _, name := range tc.files {
+				if _, ok := files[name]; !ok {
+					t.Errorf("%s is missing", name)
+				}
+			}
+			for name, data := range files {
+				if !strings.HasPrefix(name, "blobs/") {
+					continue
+				}
+				if dgst := digest.FromBytes(data); blobPath(dgst) != name {
+					t.Errorf("%s holds %s", name, dgst)
+				}
+			}
+
+			if tc.format == ExportFormatDockerArchive {
+				var images []dockerArchiveManifest
+				if err := json.Unmarshal(files["manifest.json"], &images); err != nil {
+					t.Fatal(err)
+				}
+				if len(images) != 2 || images[0].RepoTags[0] != app.String() || len(images[1].Layers) != 2 {
+					t.Errorf("manifest.json is %+v", images)
+				}
+				return
+			}
+			var index v1.Index
+			if err := json.Unmarshal(files["index.json"], &index); err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Manifests) != 2 || index.Manifests[0].Digest != appDigest || index.Manifests[1].Digest != webDigest {
+				t.Errorf("index.json is %+v", index)
+			}
+		})
+	}
+}
+
+func TestExportVerifiesDigests(t *testing.T) {
+	config, err := json.Marshal(testImageConfig("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		format ExportFormat
+		blob   digest.Digest
+	}{
+		{"layer", ExportFormatOCI, digest.FromString("app")},
+		{"config", ExportFormatOCI, digest.FromBytes(config)},
+		{"shared layer", ExportFormatDockerArchive, digest.FromString("base")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := newTestManager(t, tamperBlob(newTestRegistryApp(), tc.blob))
+			app := Tag{Repo: "app", Name: "v1"}
+			pushTestImage(t, reg, app, "app", "base", "app")
+
+			u := New(reg, Options{})
+			_, err := u.Export(context.Background(), []Tag{app}, io.Discard, ExportOptions{Format: tc.format})
+			if err == nil || !strings.Contains(err.Error(), "doesn't match its digest") {
+				t.Errorf("error %v, want a digest mismatch of %s", err, tc.blob)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+// imageConfig is a subset of the image config blob
+// https://github.com/opencontainers/image-spec/blob/main/config.md
+type imageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Variant      string    `json:"variant,omitempty"`
+	Config       struct {
+		User         string              `json:"User,omitempty"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+		Env          []string            `json:"Env,omitempty"`
+		Entrypoint   []string            `json:"Entrypoint,omitempty"`
+		Cmd          []string            `json:"Cmd,omitempty"`
+		WorkingDir   string              `json:"WorkingDir,omitempty"`
+		Labels       map[string]string   `json:"Labels,omitempty"`
+	} `json:"config"`
+}
+
+var errPlatformNotFound = errors.New("platform not found")
+
+type Layer struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Size      int64         `json:"size"`
+}
+
+type ImageDetails struct {
+	Repo      string        `json:"repo"`
+	Tag       string        `json:"tag"`
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Kind      string        `json:"kind"`
+	// PlatformDigest is a digest of the manifest picked from the index, if the tag points at one.
+	PlatformDigest digest.Digest     `json:"platformDigest,omitempty"`
+	Created        *time.Time        `json:"created,omitempty"`
+	OS             string            `json:"os"`
+	Architecture   string            `json:"architecture"`
+	Variant        string            `json:"variant,omitempty"`
+	User           string            `json:"user,omitempty"`
+	WorkingDir     string            `json:"workingDir,omitempty"`
+	Entrypoint     []string          `json:"entrypoint,omitempty"`
+	Cmd            []string          `json:"cmd,omitempty"`
+	Env            []string          `json:"env,omitempty"`
+	ExposedPorts   []string          `json:"exposedPorts,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Platforms      []PlatformInfo    `json:"platforms,omitempty"`
+	Config         Layer             `json:"config"`
+	Layers         []Layer           `json:"layers"`
+	// TotalSize is a compressed size of the config and all the layers.
+	TotalSize int64 `json:"totalSize"`
+}
+
+// Inspect shows the image of the platform, if it is set. Otherwise, the default
+// platform is picked for indexes, see resolveIndex.
+func (u *usecase) Inspect(ctx context.Context, ref Tag, platform string) (ImageDetails, error) {
+	repo, tag := ref.Repo, ref.Name
+	filter, err := parsePlatformFilter(platform)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	r, err := u.Registry.GetRepo(ctx, repo)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	desc, err := u.Registry.GetV2Descriptor(ctx, repo, tag)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	m, err := getManifest(ctx, r, desc.Digest)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	m, platformDigest, err := resolveIndex(ctx, r, m, filter)
+	if err != nil {
+		return ImageDetails{}, fmt.Errorf("%s: %w", ref, err)
+	}
+	configDesc, layers, err := getManifestBlobs(m)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	cfg, err := getConfigBlob(ctx, r, configDesc)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	if filter != nil && !cfg.platform().Match(*filter) {
+		return ImageDetails{}, fmt.Errorf("%s: %w", ref, errPlatformNotFound)
+	}
+	platforms, err := u.getPlatforms(ctx, repo, desc)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+
+	res := ImageDetails{
+		Repo:           repo,
+		Tag:            tag,
+		Digest:         desc.Digest,
+		MediaType:      desc.MediaType,
+		Kind:           docker.ManifestKind(desc.MediaType),
+		PlatformDigest: platformDigest,
+		Created:        createdTime(cfg.Created),
+		OS:             cfg.OS,
+		Architecture:   cfg.Architecture,
+		Variant:        cfg.Variant,
+		User:           cfg.Config.User,
+		WorkingDir:     cfg.Config.WorkingDir,
+		Entrypoint:     cfg.Config.Entrypoint,
+		Cmd:            cfg.Config.Cmd,
+		Env:            cfg.Config.Env,
+		Labels:         cfg.Config.Labels,
+		Platforms:      platforms,
+		Config:         layerFromDescriptor(configDesc),
+		Layers:         make([]Layer, 0, len(layers)),
+		TotalSize:      configDesc.Size,
+	}
+	for port := range cfg.Config.ExposedPorts {
+		res.ExposedPorts = append(res.ExposedPorts, port)
+	}
+	sort.Strings(res.ExposedPorts)
+	for _, l := range layers {
+		res.Layers = append(res.Layers, layerFromDescriptor(l))
+		res.TotalSize += l.Size
+	}
+	return res, nil
+}
+
+func layerFromDescriptor(desc distribution.Descriptor) Layer {
+	return Layer{Digest: desc.Digest, MediaType: desc.MediaType, Size: desc.Size}
+}
+
+// getManifestBlobs splits blobs referenced by an image manifest into the config and layers.
+func getManifestBlobs(m distribution.Manifest) (distribution.Descriptor, []distribution.Descriptor, error) {
+	switch v := m.(type) {
+	case *schema2.DeserializedManifest:
+		return v.Config, v.Layers, nil
+	case *ocischema.DeserializedManifest:
+		return v.Config, v.Layers, nil
+	default:
+		mediaType, _, _ := m.Payload()
+		return distribution.Descriptor{}, nil, fmt.Errorf("manifest of type '%s' has no config", mediaType)
+	}
+}
+
+func getManifest(ctx context.Context, r distribution.Repository, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	ms, err := r.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ms.Get(ctx, dgst, options...)
+}
+
+// resolveIndex returns the manifest itself unless it is an index. For an index it fetches
+// the manifest of the filter platform. Without a filter it is the linux/amd64 manifest
+// or the first one, if there is no such platform.
+func resolveIndex(ctx context.Context, r distribution.Repository, m distribution.Manifest, filter *docker.Platform) (distribution.Manifest, digest.Digest, error) {
+	index, ok := m.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return m, "", nil
+	}
+	if len(index.Manifests) < 1 {
+		return nil, "", fmt.Errorf("index has no manifests")
+	}
+	picked := index.Manifests[0]
+	if filter == nil {
+		filter = &docker.Platform{OS: "linux", Architecture: "amd64"}
+	} else {
+		picked = manifestlist.ManifestDescriptor{}
+	}
+	for _, v := range index.Manifests {
+		if platformOf(v).Match(*filter) {
+			picked = v
+			break
+		}
+	}
+	if len(picked.Digest) < 1 {
+		return nil, "", errPlatformNotFound
+	}
+	child, err := getManifest(ctx, r, picked.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	return child, picked.Digest, nil
+}
+
+// collectBlobs adds sizes of the config and layers of the manifest into blobs. For an index,
+// blobs of all its manifests are added along with the manifests themselves.
+func collectBlobs(ctx context.Context, r distribution.Repository, dgst digest.Digest, blobs map[digest.Digest]int64) error {
+	m, err := getManifest(ctx, r, dgst)
+	if err != nil {
+		return err
+	}
+	if index, ok := m.(*manifestlist.DeserializedManifestList); ok {
+		for _, v := range index.Manifests {
+			blobs[v.Digest] = v.Size
+			if err := collectBlobs(ctx, r, v.Digest, blobs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	config, layers, err := getManifestBlobs(m)
+	if err != nil {
+		return err
+	}
+	blobs[config.Digest] = config.Size
+	for _, l := range layers {
+		blobs[l.Digest] = l.Size
+	}
+	return nil
+}
+
+func getConfigBlob(ctx context.Context, r distribution.Repository, desc distribution.Descriptor) (imageConfig, error) {
+	cfg := imageConfig{}
+	data, err := r.Blobs(ctx).Get(ctx, desc.Digest)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, json.Unmarshal(data, &cfg)
+}
+
+// getImageConfig returns the config of the tag, errPlatformNotFound is returned if the
+// image has no platform matching the filter.
+func getImageConfig(ctx context.Context, r distribution.Repository, tag string, filter *docker.Platform) (imageConfig, error) {
+	m, err := getManifest(ctx, r, "", distribution.WithTag(tag))
+	if err != nil {
+		return imageConfig{}, err
+	}
+	m, _, err = resolveIndex(ctx, r, m, filter)
+	if err != nil {
+		return imageConfig{}, err
+	}
+	desc, _, err := getManifestBlobs(m)
+	if err != nil {
+		return imageConfig{}, err
+	}
+	cfg, err := getConfigBlob(ctx, r, desc)
+	if err != nil {
+		return cfg, err
+	}
+	if filter != nil && !cfg.platform().Match(*filter) {
+		return cfg, errPlatformNotFound
+	}
+	return cfg, nil
+}
+
+func (c imageConfig) platform() docker.Platform {
+	return docker.Platform{OS: c.OS, Architecture: c.Architecture, Variant: c.Variant}
+}
+
+func platformOf(desc manifestlist.ManifestDescriptor) docker.Platform {
+	return docker.Platform{
+		OS:           desc.Platform.OS,
+		Architecture: desc.Platform.Architecture,
+		Variant:      desc.Platform.Variant,
+	}
+}
+
+func parsePlatformFilter(platform string) (*docker.Platform, error) {
+	if len(platform) < 1 {
+		return nil, nil
+	}
+	p, err := docker.ParsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (u *usecase) getPlatforms(ctx context.Context, repo string, desc distribution.Descriptor) ([]PlatformInfo, error) {
+	platforms, err := u.Registry.GetPlatforms(ctx, repo, desc)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PlatformInfo, 0, len(platforms))
+	for _, v := range platforms {
+		res = append(res, PlatformInfo{
+			platform: v.Platform,
+			created:  v.Created,
+			Platform: v.Platform.String(),
+			Digest:   v.Descriptor.Digest,
+			Size:     v.Size,
+		})
+	}
+	return res, nil
+}
+
+func hasPlatform(platforms []PlatformInfo, filter *docker.Platform) bool {
+	for _, v := range platforms {
+		if v.platform.Match(*filter) {
+			return true
+		}
+	}
+	return false
+}
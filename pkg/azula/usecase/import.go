@@ -0,0 +1,518 @@
+package usecase
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type ImportOptions struct {
+	// Tags are pushed instead of the names kept in the archive, the archive must
+	// hold a single image then.
+	Tags []Tag
+	// ChunkSize is the size of upload requests, docker.DefaultChunkSize if zero.
+	ChunkSize int64
+	// DryRun only looks up blobs missing in the registry, nothing is uploaded.
+	DryRun bool
+}
+
+type ImportResult struct {
+	Tag    `yaml:",inline"`
+	Digest digest.Digest `json:"digest" yaml:"digest"`
+	// Blobs existing in the repository, mounted from a repository pushed before or uploaded.
+	Existing int64 `json:"existing" yaml:"existing"`
+	Mounted  int64 `json:"mounted" yaml:"mounted"`
+	Uploaded int64 `json:"uploaded" yaml:"uploaded"`
+	// Missing blobs would be uploaded, it's set in dry-run mode only.
+	Missing []digest.Digest `json:"missing,omitempty" yaml:"missing,omitempty"`
+}
+
+// archivedImage is an image of the archive with the names to push it as.
+type archivedImage struct {
+	Names []Tag
+	// Desc is the manifest or the index of an OCI layout.
+	Desc v1.Descriptor
+	// Docker is the manifest.json entry of a docker archive without an OCI layout.
+	Docker *dockerArchiveManifest
+}
+
+// Import pushes images of an OCI layout or a `docker save` tarball. Blobs the
+// repository has are skipped, the ones pushed to another repository of the import
+// are mounted from it, others are uploaded in chunks. Manifests of indexes are put
+// by digest before the index. Layers of docker archives are gzipped once, the way
+// `docker push` does. In dry-run mode manifests are resolved the
+// same way, but only blobs missing in the registry are reported.
+func (u *usecase) Import(ctx context.Context, r io.ReaderAt, size int64, opts ImportOptions) ([]ImportResult, error) {
+	a, err := openArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	images, err := a.images()
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Tags) > 0 {
+		if len(images) != 1 {
+			return nil, fmt.Errorf("the archive holds %d images, tags can be set for a single image only", len(images))
+		}
+		images[0].Names = opts.Tags
+	}
+	for i, img := range images {
+		if len(img.Names) < 1 {
+			return nil, fmt.Errorf("image %d of the archive has no name, set a tag to push it", i+1)
+		}
+	}
+
+	state := &importState{layers: map[string]*compressedLayer{}, pushed: map[digest.Digest]string{}}
+	defer state.cleanup()
+	res := make([]ImportResult, 0, len(images))
+	for _, img := range images {
+		for _, name := range img.Names {
+			v, err := u.importImage(ctx, a, state, img, name, opts)
+			if err != nil {
+				return res, fmt.Errorf("can't import %s: %w", name, err)
+			}
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (u *usecase) importImage(ctx context.Context, a *archiveReader, state *importState, img archivedImage, name Tag, opts ImportOptions) (ImportResult, error) {
+	res := ImportResult{Tag: name}
+	r, err := u.Registry.GetRepo(ctx, name.Repo)
+	if err != nil {
+		return res, err
+	}
+	p := &pusher{u: u, a: a, state: state, repo: r, name: name.Repo, chunkSize: opts.ChunkSize, dryRun: opts.DryRun, res: &res}
+	var m distribution.Manifest
+	if img.Docker != nil {
+		m, err = p.pushDockerImage(ctx, *img.Docker)
+	} else {
+		m, err = p.pushImage(ctx, img.Desc)
+	}
+	if err != nil {
+		return res, err
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		return res, err
+	}
+	res.Digest = digest.FromBytes(payload)
+	if opts.DryRun {
+		sort.Slice(res.Missing, func(i, j int) bool { return res.Missing[i] < res.Missing[j] })
+		return res, nil
+	}
+	return res, putManifest(ctx, r, m, name, res.Digest)
+}
+
+// importState is shared by the pushes of an archive.
+type importState struct {
+	mu sync.Mutex
+	// layers of docker archives by path, shared layers are gzipped once
+	layers map[string]*compressedLayer
+	// pushed keeps a repository having the blob to mount it from
+	pushed map[digest.Digest]string
+}
+
+type compressedLayer struct {
+	once    sync.Once
+	desc    distribution.Descriptor
+	content *io.SectionReader
+	cleanup func()
+	err     error
+}
+
+type pusher struct {
+	u         *usecase
+	a         *archiveReader
+	state     *importState
+	repo      distribution.Repository
+	name      string
+	chunkSize int64
+	dryRun    bool
+
+	mu  sync.Mutex
+	res *ImportResult
+}
+
+// pushImage pushes blobs of the manifest of the OCI layout, manifests of an index
+// are pushed by digest. The manifest itself is returned to be put by the caller.
+func (p *pusher) pushImage(ctx context.Context, desc v1.Descriptor) (distribution.Manifest, error) {
+	payload, err := p.a.readBlob(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if actual := desc.Digest.Algorithm().FromBytes(payload); actual != desc.Digest {
+		return nil, fmt.Errorf("manifest digest is %s, expected %s", actual, desc.Digest)
+	}
+	m, _, err := distribution.UnmarshalManifest(desc.MediaType, payload)
+	if err != nil {
+		return nil, err
+	}
+	if index, ok := m.(*manifestlist.DeserializedManifestList); ok {
+		ms, err := p.repo.Manifests(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range index.Manifests {
+			if ok, err := ms.Exists(ctx, v.Digest); err != nil {
+				return nil, err
+			} else if ok {
+				continue
+			}
+			child, err := p.pushImage(ctx, v1.Descriptor{MediaType: v.MediaType, Digest: v.Digest, Size: v.Size})
+			if err != nil {
+				return nil, err
+			}
+			if p.dryRun {
+				continue
+			}
+			if _, err := ms.Put(ctx, child); err != nil {
+				return nil, fmt.Errorf("can't put manifest %s: %w", v.Digest, err)
+			}
+		}
+		return m, nil
+	}
+
+	config, layers, err := getManifestBlobs(m)
+	if err != nil {
+		return nil, err
+	}
+	blobs := append([]distribution.Descriptor{config}, layers...)
+	return m, parallel(ctx, p.u.limit, len(blobs), func(ctx context.Context, i int) error {
+		f, err := p.a.open(blobPath(blobs[i].Digest))
+		if err != nil {
+			return err
+		}
+		return p.pushBlob(ctx, blobs[i], f)
+	})
+}
+
+// pushDockerImage pushes the config and layers of the manifest.json entry and
+// returns a schema2 manifest of them.
+func (p *pusher) pushDockerImage(ctx context.Context, image dockerArchiveManifest) (distribution.Manifest, error) {
+	blobs := make([]distribution.Descriptor, 1+len(image.Layers))
+	err := parallel(ctx, p.u.limit, len(blobs), func(ctx context.Context, i int) error {
+		if i == 0 {
+			f, err := p.a.open(image.Config)
+			if err != nil {
+				return err
+			}
+			blobs[0], err = describeBlob(f, schema2.MediaTypeImageConfig)
+			if err != nil {
+				return err
+			}
+			return p.pushBlob(ctx, blobs[0], f)
+		}
+		var layer *io.SectionReader
+		var err error
+		blobs[i], layer, err = p.state.layer(p.a, image.Layers[i-1])
+		if err != nil {
+			return err
+		}
+		return p.pushBlob(ctx, blobs[i], layer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    blobs[0],
+		Layers:    blobs[1:],
+	})
+}
+
+func (p *pusher) pushBlob(ctx context.Context, desc distribution.Descriptor, content io.ReaderAt) error {
+	if _, err := p.repo.Blobs(ctx).Stat(ctx, desc.Digest); err == nil {
+		atomic.AddInt64(&p.res.Existing, 1)
+		p.state.setPushed(desc.Digest, p.name)
+		return nil
+	} else if !errors.Is(err, distribution.ErrBlobUnknown) {
+		return err
+	}
+	if p.dryRun {
+		p.mu.Lock()
+		p.res.Missing = append(p.res.Missing, desc.Digest)
+		p.mu.Unlock()
+		return nil
+	}
+	if from, ok := p.state.mountSource(desc.Digest, p.name); ok {
+		mounted, err := mountBlob(ctx, p.repo, from, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			atomic.AddInt64(&p.res.Mounted, 1)
+			p.state.setPushed(desc.Digest, p.name)
+			return nil
+		}
+	}
+	if err := p.u.Registry.UploadBlob(ctx, p.name, desc, content, p.chunkSize); err != nil {
+		return err
+	}
+	atomic.AddInt64(&p.res.Uploaded, 1)
+	p.state.setPushed(desc.Digest, p.name)
+	return nil
+}
+
+// mountBlob asks the registry to mount the blob from the repository. The upload
+// a registry starts instead of mounting is cancelled.
+func mountBlob(ctx context.Context, dst distribution.Repository, from string, dgst digest.Digest) (bool, error) {
+	named, err := reference.WithName(from)
+	if err != nil {
+		return false, err
+	}
+	ref, err := reference.WithDigest(named, dgst)
+	if err != nil {
+		return false, err
+	}
+	w, err := dst.Blobs(ctx).Create(ctx, client.WithMountFrom(ref))
+	var mounted distribution.ErrBlobMounted
+	if errors.As(err, &mounted) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_ = w.Cancel(ctx)
+	return false, nil
+}
+
+// layer gzips the layer of the docker archive unless it was done already.
+func (s *importState) layer(a *archiveReader, name string) (distribution.Descriptor, *io.SectionReader, error) {
+	name = a.resolve(name)
+	s.mu.Lock()
+	l, ok := s.layers[name]
+	if !ok {
+		l = &compressedLayer{}
+		s.layers[name] = l
+	}
+	s.mu.Unlock()
+	l.once.Do(func() {
+		f, err := a.open(name)
+		if err != nil {
+			l.err = err
+			return
+		}
+		if l.content, l.cleanup, l.err = gzipLayer(f); l.err != nil {
+			return
+		}
+		l.desc, l.err = describeBlob(l.content, schema2.MediaTypeLayer)
+	})
+	return l.desc, l.content, l.err
+}
+
+// mountSource returns another repository the blob was pushed to.
+func (s *importState) mountSource(dgst digest.Digest, repo string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from, ok := s.pushed[dgst]
+	return from, ok && from != repo
+}
+
+func (s *importState) setPushed(dgst digest.Digest, repo string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushed[dgst] = repo
+}
+
+func (s *importState) cleanup() {
+	for _, l := range s.layers {
+		if l.cleanup != nil {
+			l.cleanup()
+		}
+	}
+}
+
+// describeBlob digests the content, the size of the section is the size of the blob.
+func describeBlob(content *io.SectionReader, mediaType string) (distribution.Descriptor, error) {
+	dgst, err := digest.FromReader(io.NewSectionReader(content, 0, content.Size()))
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{MediaType: mediaType, Digest: dgst, Size: content.Size()}, nil
+}
+
+// gzipLayer returns the layer as is if it is gzipped, otherwise the layer is
+// compressed into a temporary file removed by cleanup.
+func gzipLayer(layer *io.SectionReader) (*io.SectionReader, func(), error) {
+	magic := make([]byte, 2)
+	if _, err := layer.ReadAt(magic, 0); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return layer, func() {}, nil
+	}
+	f, err := os.CreateTemp("", "azula-layer-*.tar.gz")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := io.Copy(zw, io.NewSectionReader(layer, 0, layer.Size())); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if err := zw.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return io.NewSectionReader(f, 0, info.Size()), cleanup, nil
+}
+
+// archiveReader gives random access to regular files of a tar archive.
+type archiveReader struct {
+	r     io.ReaderAt
+	files map[string]*io.SectionReader
+	links map[string]string
+}
+
+func openArchive(r io.ReaderAt, size int64) (*archiveReader, error) {
+	a := &archiveReader{r: r, files: map[string]*io.SectionReader{}, links: map[string]string{}}
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read archive: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case hdr.Typeflag == tar.TypeSymlink:
+			// docker save links layers shared by images
+			a.links[name] = path.Join(path.Dir(name), hdr.Linkname)
+		case hdr.Typeflag == tar.TypeLink:
+			a.links[name] = path.Clean(hdr.Linkname)
+		case hdr.FileInfo().Mode().IsRegular():
+			// the reader doesn't buffer, so the offset is the start of the file
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			a.files[name] = io.NewSectionReader(r, offset, hdr.Size)
+		}
+	}
+	return a, nil
+}
+
+func (a *archiveReader) open(name string) (*io.SectionReader, error) {
+	name = a.resolve(name)
+	f, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in the archive", name)
+	}
+	return io.NewSectionReader(f, 0, f.Size()), nil
+}
+
+// resolve follows links to the file.
+func (a *archiveReader) resolve(name string) string {
+	name = path.Clean(name)
+	for i := 0; i < 8; i++ {
+		if target, ok := a.links[name]; ok {
+			name = target
+		}
+	}
+	return name
+}
+
+func (a *archiveReader) read(name string) ([]byte, error) {
+	f, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+func (a *archiveReader) readBlob(dgst digest.Digest) ([]byte, error) {
+	return a.read(blobPath(dgst))
+}
+
+// images lists images of the OCI layout, if the archive has one, otherwise the
+// images of manifest.json of `docker save`.
+func (a *archiveReader) images() ([]archivedImage, error) {
+	if _, ok := a.files[v1.ImageLayoutFile]; ok {
+		data, err := a.read("index.json")
+		if err != nil {
+			return nil, err
+		}
+		index := v1.Index{}
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("can't parse index.json: %w", err)
+		}
+		res := make([]archivedImage, 0, len(index.Manifests))
+		for _, desc := range index.Manifests {
+			img := archivedImage{Desc: desc}
+			if name := desc.Annotations[annotationImageName]; len(name) > 0 {
+				tag, err := archivedName(name)
+				if err != nil {
+					return nil, err
+				}
+				img.Names = append(img.Names, tag)
+			}
+			res = append(res, img)
+		}
+		return res, nil
+	}
+
+	data, err := a.read("manifest.json")
+	if err != nil {
+		return nil, errors.New("neither an OCI layout nor a docker archive: no oci-layout and manifest.json")
+	}
+	entries := []dockerArchiveManifest{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("can't parse manifest.json: %w", err)
+	}
+	res := make([]archivedImage, 0, len(entries))
+	for i := range entries {
+		img := archivedImage{Docker: &entries[i]}
+		for _, name := range entries[i].RepoTags {
+			tag, err := archivedName(name)
+			if err != nil {
+				return nil, err
+			}
+			img.Names = append(img.Names, tag)
+		}
+		res = append(res, img)
+	}
+	return res, nil
+}
+
+// archivedName parses the image name of an archive, the registry host is dropped
+// like the docker cli would do: the first part of the path with a dot, a colon
+// or localhost is the host.
+func archivedName(name string) (Tag, error) {
+	if i := strings.Index(name, "/"); i > 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			name = name[i+1:]
+		}
+	}
+	return ParseTag(name)
+}
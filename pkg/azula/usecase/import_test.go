@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// failPatches answers 500 to the PATCH requests of the numbers, from 1, without
+// passing them to the registry.
+func failPatches(h http.Handler, numbers ...int) http.Handler {
+	var mu sync.Mutex
+	patches := 0
+	fail := map[int]bool{}
+	for _, n := range numbers {
+		fail[n] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			mu.Lock()
+			patches++
+			failed := fail[patches]
+			mu.Unlock()
+			if failed {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestImportExported(t *testing.T) {
+	src := newTestRegistry(t)
+	app := Tag{Repo: "app", Name: "v1"}
+	web := Tag{Repo: "web", Name: "v1"}
+	digests := map[Tag]digest.Digest{
+		app: pushTestImage(t, src, app, "app", "base layer", "app layer"),
+		web: pushTestImage(t, src, web, "web", "base layer", "web layer"),
+	}
+	var archive bytes.Buffer
+	if _, err := New(src, Options{}).Export(context.Background(), []Tag{app, web}, &archive, ExportOptions{Format: ExportFormatOCI}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		chunkSize int64
+		failures  []int
+		// existing images are pushed before the import
+		existing []Tag
+		dryRun   bool
+		// uploaded, mounted and existing blobs of web, mounted ones are the ones of app
+		uploaded, mounted, skipped int64
+	}{
+		{name: "whole blobs", uploaded: 2, mounted: 1},
+		{name: "chunks", chunkSize: 3, uploaded: 2, mounted: 1},
+		{name: "failed chunks resumed", chunkSize: 3, failures: []int{2, 5, 6}, uploaded: 2, mounted: 1},
+		{name: "existing blobs", chunkSize: 3, existing: []Tag{web}, skipped: 3},
+		{name: "dry run", dryRun: true, existing: []Tag{app}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := newTestManager(t, failPatches(newTestRegistryApp(), tc.failures...))
+			for _, ref := range tc.existing {
+				pushTestImage(t, dst, ref, ref.Repo, "base layer", ref.Repo+" layer")
+			}
+			u := New(dst, Options{Concurrency: 1})
+			res, err := u.Import(context.Background(), bytes.NewReader(archive.Bytes()), int64(archive.Len()), ImportOptions{ChunkSize: tc.chunkSize, DryRun: tc.dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 2 || res[0].Tag != app || res[1].Tag != web {
+				t.Fatalf("imported %+v, want %s and %s", res, app, web)
+			}
+			if tc.dryRun {
+				if len(res[0].Missing) != 0 || len(res[1].Missing) != 3 {
+					t.Errorf("missing blobs %v and %v, want none of %s and 3 of %s", res[0].Missing, res[1].Missing, app, web)
+				}
+				if _, err := dst.GetV2Descriptor(context.Background(), web.Repo, web.Name); err == nil {
+					t.Errorf("%s is pushed in dry-run mode", web)
+				}
+				return
+			}
+			w := res[1]
+			if w.Uploaded != tc.uploaded || w.Mounted != tc.mounted || w.Existing != tc.skipped {
+				t.Errorf("%s: uploaded %d, mounted %d, existing %d, want %d, %d, %d", web, w.Uploaded, w.Mounted, w.Existing, tc.uploaded, tc.mounted, tc.skipped)
+			}
+			for _, v := range res {
+				if v.Digest != digests[v.Tag] {
+					t.Errorf("%s is imported as %s, want %s", v.Tag, v.Digest, digests[v.Tag])
+				}
+				checkDigest(t, dst, v.Tag, v.Digest)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Repository is a repository of the registry.
+type Repository struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// Tag references a manifest of a repository by name.
+type Tag struct {
+	Repo string `json:"repo" yaml:"repo"`
+	Name string `json:"tag" yaml:"tag"`
+}
+
+// Manifest describes what a tag points at.
+type Manifest struct {
+	Digest    digest.Digest `json:"digest" yaml:"digest"`
+	Size      int64         `json:"size" yaml:"size"`
+	MediaType string        `json:"mediaType" yaml:"mediaType"`
+	Kind      string        `json:"kind" yaml:"kind"`
+	// Platforms are the platforms of an index or the only platform of an image.
+	Platforms []PlatformInfo `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	// Created is taken from the config of an image, it's nil for indexes and
+	// images which are not described.
+	Created *time.Time `json:"created,omitempty" yaml:"created,omitempty"`
+}
+
+// Image is a tag with the manifest it points at, the manifest is empty unless the image is described.
+type Image struct {
+	Tag      `yaml:",inline"`
+	Manifest `yaml:",inline"`
+}
+
+type PlatformInfo struct {
+	platform docker.Platform
+	created  time.Time
+
+	Platform string        `json:"platform" yaml:"platform"`
+	Digest   digest.Digest `json:"digest" yaml:"digest"`
+	// Size is a compressed size of the config and all the layers.
+	Size int64 `json:"size" yaml:"size"`
+}
+
+func (t Tag) String() string {
+	return t.Repo + ":" + t.Name
+}
+
+// ParseTag parses references in repo:tag format.
+func ParseTag(ref string) (Tag, error) {
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return Tag{}, fmt.Errorf("reference '%s' must be in repo:tag format", ref)
+	}
+	t := Tag{Repo: ref[:i], Name: ref[i+1:]}
+	if len(t.Repo) < 1 || len(t.Name) < 1 {
+		return Tag{}, fmt.Errorf("repo or tag empty. repo: '%s', tag: '%s'", t.Repo, t.Name)
+	}
+	return t, nil
+}
+
+// ParseTags parses references in repo:tag format.
+func ParseTags(refs []string) ([]Tag, error) {
+	res := make([]Tag, 0, len(refs))
+	for _, v := range refs {
+		t, err := ParseTag(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// RepositoryNames returns names of the repos.
+func RepositoryNames(repos []Repository) []string {
+	res := make([]string, 0, len(repos))
+	for _, v := range repos {
+		res = append(res, v.Name)
+	}
+	return res
+}
+
+// createdTime returns nil for the zero time of configs without a created date.
+func createdTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
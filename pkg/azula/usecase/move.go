@@ -0,0 +1,188 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// MoveRule renames repositories matching Pattern, Replacement may refer to
+// submatches like regexp.Regexp.ReplaceAllString does.
+type MoveRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+type MoveOptions struct {
+	// Overwrite moves destination tags pointing at other manifests.
+	Overwrite bool
+	// DeleteSource deletes the source tags, which were copied and verified.
+	DeleteSource bool
+	// ContinueOnError goes through all the items reporting failures in the results.
+	ContinueOnError bool
+}
+
+// MoveItem is a tag to copy, Digest is the manifest the source pointed at when planning.
+type MoveItem struct {
+	Src    Tag           `json:"src" yaml:"src"`
+	Dst    Tag           `json:"dst" yaml:"dst"`
+	Digest digest.Digest `json:"digest" yaml:"digest"`
+}
+
+type MoveStatus string
+
+const (
+	// MoveStatusCopied items have the same digest in both repositories.
+	MoveStatusCopied MoveStatus = "copied"
+	// MoveStatusMoved items are copied and the source tag is deleted.
+	MoveStatusMoved   MoveStatus = "moved"
+	MoveStatusFailed  MoveStatus = "failed"
+	MoveStatusSkipped MoveStatus = "skipped"
+)
+
+type MoveResult struct {
+	MoveItem `yaml:",inline"`
+	Status   MoveStatus `json:"status" yaml:"status"`
+	Err      error      `json:"-" yaml:"-"`
+}
+
+// PlanMove resolves every tag of the repositories matching the rule to the
+// tag of the renamed repository, nothing is changed.
+func (u *usecase) PlanMove(ctx context.Context, rule MoveRule, maxEntries int) ([]MoveItem, error) {
+	repos, err := u.ListReposLike(ctx, "", maxEntries)
+	if err != nil {
+		return nil, err
+	}
+	src := make([]Repository, 0, len(repos))
+	dst := make([]Repository, 0, len(repos))
+	for _, repo := range repos {
+		if !rule.Pattern.MatchString(repo.Name) {
+			continue
+		}
+		name := rule.Pattern.ReplaceAllString(repo.Name, rule.Replacement)
+		if name == repo.Name {
+			continue
+		}
+		if _, err := reference.WithName(name); err != nil {
+			return nil, fmt.Errorf("can't move %s to '%s': %w", repo.Name, name, err)
+		}
+		src = append(src, repo)
+		dst = append(dst, Repository{Name: name})
+	}
+	// a destination, which is moved itself, would get tags of both repositories
+	moved := map[string]bool{}
+	for _, repo := range src {
+		moved[repo.Name] = true
+	}
+	names := map[string]string{}
+	for i, repo := range dst {
+		if other, ok := names[repo.Name]; ok {
+			return nil, fmt.Errorf("both %s and %s are moved to %s", other, src[i].Name, repo.Name)
+		}
+		if moved[repo.Name] {
+			return nil, fmt.Errorf("%s is moved to %s, which is moved too", src[i].Name, repo.Name)
+		}
+		names[repo.Name] = src[i].Name
+	}
+	tags, err := u.repoTags(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]MoveItem, 0, 4)
+	for i, repo := range src {
+		for _, tag := range tags[i] {
+			items = append(items, MoveItem{
+				Src: Tag{Repo: repo.Name, Name: tag},
+				Dst: Tag{Repo: dst[i].Name, Name: tag},
+			})
+		}
+	}
+	err = parallel(ctx, u.limit, len(items), func(ctx context.Context, i int) error {
+		desc, err := u.Registry.GetV2Descriptor(ctx, items[i].Src.Repo, items[i].Src.Name)
+		items[i].Digest = desc.Digest
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ApplyMove copies the items and verifies both tags still point at the planned
+// digest. With DeleteSource the verified source tags are deleted afterwards
+// with DeleteImageByTag, so nothing is deleted if a copy failed without
+// ContinueOnError.
+func (u *usecase) ApplyMove(ctx context.Context, items []MoveItem, opts MoveOptions) ([]MoveResult, error) {
+	res := make([]MoveResult, len(items))
+	var firstErr error
+	for i, item := range items {
+		res[i] = MoveResult{MoveItem: item, Status: MoveStatusSkipped}
+		if firstErr != nil {
+			continue
+		}
+		if err := u.moveItem(ctx, item, opts); err != nil {
+			res[i].Status, res[i].Err = MoveStatusFailed, err
+			if !opts.ContinueOnError {
+				firstErr = err
+			}
+			continue
+		}
+		res[i].Status = MoveStatusCopied
+	}
+	if !opts.DeleteSource || firstErr != nil {
+		return res, firstErr
+	}
+
+	refs := make([]Tag, 0, len(res))
+	for _, v := range res {
+		if v.Status == MoveStatusCopied {
+			refs = append(refs, v.Src)
+		}
+	}
+	if len(refs) < 1 {
+		return res, nil
+	}
+	deleted, err := u.DeleteImageByTag(ctx, refs, DeleteOptions{ContinueOnError: opts.ContinueOnError})
+	status := map[Tag]DeleteResult{}
+	for _, v := range deleted {
+		for _, tag := range v.Tags {
+			status[Tag{Repo: v.Repo, Name: tag}] = v
+		}
+	}
+	for i := range res {
+		v, ok := status[res[i].Src]
+		if res[i].Status != MoveStatusCopied || !ok {
+			continue
+		}
+		switch v.Status {
+		case DeleteStatusDeleted:
+			res[i].Status = MoveStatusMoved
+		case DeleteStatusSkipped:
+		default:
+			res[i].Err = fmt.Errorf("copied, but the source isn't deleted: %w", v.Err)
+		}
+	}
+	return res, err
+}
+
+func (u *usecase) moveItem(ctx context.Context, item MoveItem, opts MoveOptions) error {
+	copied, err := u.Copy(ctx, item.Src, item.Dst, CopyOptions{Overwrite: opts.Overwrite})
+	if err != nil {
+		return err
+	}
+	if copied.Digest != item.Digest {
+		return fmt.Errorf("%s changed since planning: %s, expected %s", item.Src, copied.Digest, item.Digest)
+	}
+	desc, err := u.Registry.GetV2Descriptor(ctx, item.Dst.Repo, item.Dst.Name)
+	if err != nil {
+		return err
+	}
+	if desc.Digest != item.Digest {
+		return fmt.Errorf("digest of %s is %s, expected %s", item.Dst, desc.Digest, item.Digest)
+	}
+	return nil
+}
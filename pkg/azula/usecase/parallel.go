@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is the number of registry calls made at once if Options don't set it.
+const DefaultConcurrency = 8
+
+// limiter bounds registry calls made at once by all the parallel calls sharing it,
+// including the nested ones. A call holds a slot of every semaphore of the limiter,
+// semaphores are taken in order, so limiters of several registries can be combined.
+type limiter []chan struct{}
+
+func newLimiter(n int) limiter {
+	if n < 1 {
+		n = 1
+	}
+	return limiter{make(chan struct{}, n)}
+}
+
+// and combines the limiters, calls hold slots of both of them.
+func (l limiter) and(other limiter) limiter {
+	return append(append(limiter{}, l...), other...)
+}
+
+func (l limiter) size() int {
+	res := 0
+	for i, sem := range l {
+		if i == 0 || cap(sem) < res {
+			res = cap(sem)
+		}
+	}
+	return res
+}
+
+func (l limiter) acquire(ctx context.Context) error {
+	for i, sem := range l {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			l[:i].release()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (l limiter) release() {
+	for i := len(l) - 1; i >= 0; i-- {
+		<-l[i]
+	}
+}
+
+type heldKey struct{}
+
+// parallel calls fn for every index of [0, n), every call holds a slot of the limiter.
+// Callers keep results by index to preserve the order. The first error cancels
+// the context of the other calls and is returned.
+//
+// A call of fn running parallel again gives its slots back until the nested calls
+// are done, so they can't wait for each other and the limit holds for all of them.
+func parallel(ctx context.Context, l limiter, n int, fn func(ctx context.Context, i int) error) error {
+	if held, ok := ctx.Value(heldKey{}).(limiter); ok {
+		held.release()
+		defer func() {
+			// the slots are taken back even if the context is done, the caller releases them
+			_ = held.acquire(context.Background())
+		}()
+	}
+	workers := l.size()
+	if workers > n {
+		workers = n
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// select may pick an index or a slot over the done context
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := l.acquire(ctx); err != nil {
+					fail(err)
+					continue
+				}
+				err := fn(context.WithValue(ctx, heldKey{}, l), i)
+				l.release()
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// repoTags fetches tags of the repos, tags of repos[i] are at i.
+func (u *usecase) repoTags(ctx context.Context, repos []Repository) ([][]string, error) {
+	res := make([][]string, len(repos))
+	err := parallel(ctx, u.limit, len(repos), func(ctx context.Context, i int) error {
+		r, err := u.Registry.GetRepo(ctx, repos[i].Name)
+		if err != nil {
+			return err
+		}
+		res[i], err = r.Tags(ctx).All(ctx)
+		return err
+	})
+	return res, err
+}
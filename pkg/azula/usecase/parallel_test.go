@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// callCounter tracks the number of calls running at once.
+type callCounter struct {
+	running, max, total int32
+}
+
+func (c *callCounter) call() {
+	n := atomic.AddInt32(&c.running, 1)
+	for {
+		max := atomic.LoadInt32(&c.max)
+		if n <= max || atomic.CompareAndSwapInt32(&c.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&c.running, -1)
+	atomic.AddInt32(&c.total, 1)
+}
+
+func TestParallelNestedCallsShareLimit(t *testing.T) {
+	l := newLimiter(3)
+	calls := &callCounter{}
+	done := make(chan error)
+	go func() {
+		done <- parallel(context.Background(), l, 10, func(ctx context.Context, i int) error {
+			calls.call()
+			err := parallel(ctx, l, 10, func(ctx context.Context, j int) error {
+				calls.call()
+				return nil
+			})
+			calls.call()
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("nested calls are stuck")
+	}
+	if calls.total != 120 {
+		t.Errorf("%d calls made, want 120", calls.total)
+	}
+	if calls.max > 3 {
+		t.Errorf("%d calls at once, want at most 3", calls.max)
+	}
+}
+
+func TestParallelCombinedLimits(t *testing.T) {
+	src, dst := newLimiter(4), newLimiter(2)
+	calls := &callCounter{}
+	// calls of dst alone hold its slots too
+	done := make(chan error)
+	go func() {
+		done <- parallel(context.Background(), dst, 20, func(ctx context.Context, i int) error {
+			calls.call()
+			return nil
+		})
+	}()
+	err := parallel(context.Background(), src.and(dst), 20, func(ctx context.Context, i int) error {
+		calls.call()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if calls.max > 2 {
+		t.Errorf("%d calls at once, want at most 2", calls.max)
+	}
+}
+
+func TestParallelStopsAtFirstError(t *testing.T) {
+	fail := errors.New("fail")
+	var called int32
+	err := parallel(context.Background(), newLimiter(1), 10, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&called, 1)
+		if i == 2 {
+			return fail
+		}
+		return nil
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("error %v, want %v", err, fail)
+	}
+	if called != 3 {
+		t.Errorf("%d calls made after the error, want 3", called)
+	}
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+type PruneRules struct {
+	KeepLast     int
+	OlderThan    time.Duration
+	TagRegex     *regexp.Regexp
+	ExcludeRegex *regexp.Regexp
+	// Platform keeps only tags having it, the age is taken from the config of that platform.
+	Platform string
+}
+
+type PruneCandidate struct {
+	Tag
+	// Created is nil if the config has no date, such images are always kept.
+	Created *time.Time
+	Delete  bool
+	Reason  string
+}
+
+// PlanPrune applies rules to tags of every repo and returns the candidates ordered
+// from the newest to the oldest one within a repo, images without a date go last.
+// Tags filtered out by regexps are not returned at all.
+func (u *usecase) PlanPrune(ctx context.Context, repos []Repository, rules PruneRules) ([]PruneCandidate, error) {
+	if rules.KeepLast < 1 && rules.OlderThan <= 0 && rules.TagRegex == nil {
+		return nil, errors.New("at least one of keep-last, older-than or tag-regex rules is required")
+	}
+	filter, err := parsePlatformFilter(rules.Platform)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	repoTags, err := u.repoTags(ctx, repos)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PruneCandidate, 0, 4)
+	for n, repo := range repos {
+		r, err := u.Registry.GetRepo(ctx, repo.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		tags := make([]string, 0, len(repoTags[n]))
+		for _, tag := range repoTags[n] {
+			if rules.TagRegex != nil && !rules.TagRegex.MatchString(tag) {
+				continue
+			}
+			if rules.ExcludeRegex != nil && rules.ExcludeRegex.MatchString(tag) {
+				continue
+			}
+			tags = append(tags, tag)
+		}
+		found := make([]*PruneCandidate, len(tags))
+		err = parallel(ctx, u.limit, len(tags), func(ctx context.Context, i int) error {
+			cfg, err := getImageConfig(ctx, r, tags[i], filter)
+			if errors.Is(err, errPlatformNotFound) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("can't get config of %s:%s: %w", repo.Name, tags[i], err)
+			}
+			found[i] = &PruneCandidate{Tag: Tag{Repo: repo.Name, Name: tags[i]}, Created: createdTime(cfg.Created)}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		candidates := make([]PruneCandidate, 0, len(tags))
+		for _, c := range found {
+			if c != nil {
+				candidates = append(candidates, *c)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].Created == nil || candidates[j].Created == nil {
+				return candidates[j].Created == nil && candidates[i].Created != nil
+			}
+			return candidates[i].Created.After(*candidates[j].Created)
+		})
+
+		for i := range candidates {
+			c := &candidates[i]
+			// undated images go last, so they don't shift the index of dated ones
+			switch {
+			case c.Created == nil:
+				c.Reason = "no created date"
+			case i < rules.KeepLast:
+				c.Reason = fmt.Sprintf("one of the last %d", rules.KeepLast)
+			case rules.OlderThan > 0 && now.Sub(*c.Created) < rules.OlderThan:
+				c.Reason = fmt.Sprintf("newer than %s", rules.OlderThan)
+			default:
+				c.Delete = true
+			}
+		}
+		res = append(res, candidates...)
+	}
+	return res, nil
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlanPruneKeepsUndatedImages(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"new": time.Hour, "old": 48 * time.Hour, "older": 72 * time.Hour} {
+		cfg := testImageConfig(name)
+		cfg["created"] = now.Add(-age).UTC().Format(time.RFC3339)
+		pushTestImageConfig(t, reg, Tag{"app", name}, cfg, name)
+	}
+	pushTestImage(t, reg, Tag{"app", "undated"}, "undated", "undated")
+	// from the newest to the oldest one, undated images go last
+	order := []string{"new", "old", "older", "undated"}
+
+	for _, tc := range []struct {
+		name   string
+		rules  PruneRules
+		delete map[string]bool
+	}{
+		{
+			name:   "older than",
+			rules:  PruneRules{OlderThan: 24 * time.Hour},
+			delete: map[string]bool{"old": true, "older": true},
+		},
+		{
+			name:   "keep last",
+			rules:  PruneRules{KeepLast: 2},
+			delete: map[string]bool{"older": true},
+		},
+		{
+			name:   "keep last of more than dated",
+			rules:  PruneRules{KeepLast: 3},
+			delete: map[string]bool{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := New(reg, Options{}).PlanPrune(ctx, []Repository{{Name: "app"}}, tc.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != len(order) {
+				t.Fatalf("%d candidates, want %d", len(res), len(order))
+			}
+			for i, c := range res {
+				if c.Name != order[i] {
+					t.Errorf("candidate %d is %s, want %s", i, c.Name, order[i])
+				}
+				if c.Delete != tc.delete[c.Name] {
+					t.Errorf("%s: delete %t, want %t (%s)", c.Name, c.Delete, tc.delete[c.Name], c.Reason)
+				}
+				if c.Name == "undated" && (c.Created != nil || c.Reason != "no created date") {
+					t.Errorf("undated: created %v, reason '%s'", c.Created, c.Reason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/opencontainers/go-digest"
+)
+
+type SyncUsecase interface {
+	PlanSync(context.Context, SyncOptions) ([]SyncItem, error)
+	ApplySync(context.Context, []SyncItem, SyncOptions) ([]SyncResult, error)
+}
+
+type SyncOptions struct {
+	// Include and Exclude filter repositories by name, all repositories are synced if both are nil.
+	Include *regexp.Regexp
+	Exclude *regexp.Regexp
+	// TagRegex and ExcludeTagRegex filter tags the way PruneRules do.
+	TagRegex        *regexp.Regexp
+	ExcludeTagRegex *regexp.Regexp
+	// DeleteExtraneous deletes tags of the destination, which are missing in the source.
+	// Only repositories and tags passing the filters are touched.
+	DeleteExtraneous bool
+	// MaxEntries limits the number of listed repositories of every registry.
+	MaxEntries int
+	// ContinueOnError goes through all the items reporting failures in the results.
+	ContinueOnError bool
+}
+
+type SyncAction string
+
+const (
+	SyncActionCopy     SyncAction = "copy"
+	SyncActionUpdate   SyncAction = "update"
+	SyncActionUpToDate SyncAction = "up to date"
+	SyncActionDelete   SyncAction = "delete"
+)
+
+// SyncItem is a tag of the destination and what has to be done to it.
+type SyncItem struct {
+	Tag    `yaml:",inline"`
+	Digest digest.Digest `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Action SyncAction    `json:"action" yaml:"action"`
+}
+
+type SyncStatus string
+
+const (
+	SyncStatusDone    SyncStatus = "done"
+	SyncStatusFailed  SyncStatus = "failed"
+	SyncStatusSkipped SyncStatus = "skipped"
+)
+
+type SyncResult struct {
+	SyncItem `yaml:",inline"`
+	Status   SyncStatus `json:"status" yaml:"status"`
+	// Blobs existing in the destination or uploaded to it.
+	Existing int64 `json:"existing" yaml:"existing"`
+	Uploaded int64 `json:"uploaded" yaml:"uploaded"`
+	Err      error `json:"-" yaml:"-"`
+}
+
+type syncUsecase struct {
+	src *usecase
+	dst *usecase
+	// both limits calls made to both registries at once
+	both limiter
+}
+
+// NewSync replicates repositories of the src registry to the dst one, the options
+// of every registry limit calls made to it.
+func NewSync(src, dst docker.Manager, srcOpts, dstOpts Options) SyncUsecase {
+	s := &syncUsecase{
+		src: New(src, srcOpts).(*usecase),
+		dst: New(dst, dstOpts).(*usecase),
+	}
+	s.both = s.src.limit.and(s.dst.limit)
+	return s
+}
+
+// PlanSync compares tags of the matched repositories by digest, nothing is changed.
+// Tags pointing at the same manifest in both registries are up to date, so a sync
+// interrupted in the middle is resumed by planning it again.
+func (s *syncUsecase) PlanSync(ctx context.Context, opts SyncOptions) ([]SyncItem, error) {
+	srcRepos, err := s.src.syncRepos(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	repos := srcRepos
+	if opts.DeleteExtraneous {
+		dstRepos, err := s.dst.syncRepos(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		repos = mergeRepositories(srcRepos, dstRepos)
+	}
+	srcTags, err := s.src.existingRepoTags(ctx, repos)
+	if err != nil {
+		return nil, err
+	}
+	dstTags, err := s.dst.existingRepoTags(ctx, repos)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]SyncItem, 0, 4)
+	for i, repo := range repos {
+		inDst := map[string]bool{}
+		for _, tag := range filterTags(dstTags[i], opts) {
+			inDst[tag] = true
+		}
+		inSrc := map[string]bool{}
+		for _, tag := range filterTags(srcTags[i], opts) {
+			inSrc[tag] = true
+			action := SyncActionCopy
+			if inDst[tag] {
+				action = SyncActionUpdate
+			}
+			items = append(items, SyncItem{Tag: Tag{Repo: repo.Name, Name: tag}, Action: action})
+		}
+		if !opts.DeleteExtraneous {
+			continue
+		}
+		for _, tag := range filterTags(dstTags[i], opts) {
+			if !inSrc[tag] {
+				items = append(items, SyncItem{Tag: Tag{Repo: repo.Name, Name: tag}, Action: SyncActionDelete})
+			}
+		}
+	}
+
+	// items are resolved in both registries, so calls hold slots of both limits
+	err = parallel(ctx, s.both, len(items), func(ctx context.Context, i int) error {
+		item := &items[i]
+		if item.Action == SyncActionDelete {
+			desc, err := s.dst.Registry.GetV2Descriptor(ctx, item.Repo, item.Name)
+			item.Digest = desc.Digest
+			return err
+		}
+		desc, err := s.src.Registry.GetV2Descriptor(ctx, item.Repo, item.Name)
+		if err != nil {
+			return err
+		}
+		item.Digest = desc.Digest
+		if item.Action != SyncActionUpdate {
+			return nil
+		}
+		current, err := s.dst.Registry.GetV2Descriptor(ctx, item.Repo, item.Name)
+		if err != nil {
+			return err
+		}
+		if current.Digest == desc.Digest {
+			item.Action = SyncActionUpToDate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ApplySync copies manifests of the copy and update items one by one, blobs and
+// manifests of indexes already present in the destination are not uploaded again.
+// Delete items are deleted with the delete path of the destination afterwards,
+// so the manifests shared with other tags are not deleted.
+//
+// A result is returned for every item. Without ContinueOnError the first failure
+// is returned too and the items left are skipped.
+func (s *syncUsecase) ApplySync(ctx context.Context, items []SyncItem, opts SyncOptions) ([]SyncResult, error) {
+	res := make([]SyncResult, len(items))
+	deletes := make([]Tag, 0, 4)
+	var firstErr error
+	for i, item := range items {
+		res[i] = SyncResult{SyncItem: item, Status: SyncStatusSkipped}
+		switch {
+		case item.Action == SyncActionUpToDate:
+			res[i].Status = SyncStatusDone
+			continue
+		case item.Action == SyncActionDelete:
+			deletes = append(deletes, item.Tag)
+			continue
+		case firstErr != nil:
+			continue
+		}
+		if err := s.copyItem(ctx, &res[i]); err != nil {
+			res[i].Status, res[i].Err = SyncStatusFailed, err
+			if !opts.ContinueOnError {
+				firstErr = err
+			}
+			continue
+		}
+		res[i].Status = SyncStatusDone
+	}
+	if len(deletes) < 1 || firstErr != nil {
+		return res, firstErr
+	}
+
+	deleted, err := s.dst.DeleteImageByTag(ctx, deletes, DeleteOptions{ContinueOnError: opts.ContinueOnError})
+	status := map[Tag]DeleteResult{}
+	for _, v := range deleted {
+		for _, tag := range v.Tags {
+			status[Tag{Repo: v.Repo, Name: tag}] = v
+		}
+	}
+	for i := range res {
+		v, ok := status[res[i].Tag]
+		if res[i].Action != SyncActionDelete || !ok {
+			continue
+		}
+		switch v.Status {
+		case DeleteStatusDeleted:
+			res[i].Status = SyncStatusDone
+		case DeleteStatusSkipped:
+		default:
+			res[i].Status, res[i].Err = SyncStatusFailed, v.Err
+		}
+	}
+	return res, err
+}
+
+func (s *syncUsecase) copyItem(ctx context.Context, res *SyncResult) error {
+	srcRepo, err := s.src.Registry.GetRepo(ctx, res.Repo)
+	if err != nil {
+		return err
+	}
+	dstRepo, err := s.dst.Registry.GetRepo(ctx, res.Repo)
+	if err != nil {
+		return err
+	}
+	m, err := getManifest(ctx, srcRepo, res.Digest)
+	if err != nil {
+		return err
+	}
+	copied := CopyResult{}
+	if err := copyContent(ctx, s.both, srcRepo, dstRepo, m, false, &copied); err != nil {
+		return fmt.Errorf("can't sync %s: %w", res.Tag, err)
+	}
+	res.Existing, res.Uploaded = copied.Existing, copied.Uploaded
+	return putManifest(ctx, dstRepo, m, res.Tag, res.Digest)
+}
+
+// syncRepos lists repositories of the registry passing the filters of opts.
+func (u *usecase) syncRepos(ctx context.Context, opts SyncOptions) ([]Repository, error) {
+	repos, err := u.ListReposLike(ctx, "", opts.MaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	res := repos[:0]
+	for _, v := range repos {
+		if opts.Include != nil && !opts.Include.MatchString(v.Name) {
+			continue
+		}
+		if opts.Exclude != nil && opts.Exclude.MatchString(v.Name) {
+			continue
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// existingRepoTags is repoTags, which treats missing repositories as having no tags.
+func (u *usecase) existingRepoTags(ctx context.Context, repos []Repository) ([][]string, error) {
+	res := make([][]string, len(repos))
+	err := parallel(ctx, u.limit, len(repos), func(ctx context.Context, i int) error {
+		r, err := u.Registry.GetRepo(ctx, repos[i].Name)
+		if err != nil {
+			return err
+		}
+		res[i], err = r.Tags(ctx).All(ctx)
+		if err = docker.FromError(err); errors.Is(err, docker.ErrNameUnknown) {
+			return nil
+		}
+		return err
+	})
+	return res, err
+}
+
+func filterTags(tags []string, opts SyncOptions) []string {
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if opts.TagRegex != nil && !opts.TagRegex.MatchString(tag) {
+			continue
+		}
+		if opts.ExcludeTagRegex != nil && opts.ExcludeTagRegex.MatchString(tag) {
+			continue
+		}
+		res = append(res, tag)
+	}
+	return res
+}
+
+func mergeRepositories(a, b []Repository) []Repository {
+	seen := map[string]bool{}
+	res := make([]Repository, 0, len(a)+len(b))
+	for _, v := range append(append([]Repository{}, a...), b...) {
+		if !seen[v.Name] {
+			seen[v.Name] = true
+			res = append(res, v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+func syncActions(items []SyncItem) map[Tag]SyncAction {
+	res := map[Tag]SyncAction{}
+	for _, v := range items {
+		res[v.Tag] = v.Action
+	}
+	return res
+}
+
+func checkSyncActions(t *testing.T, items []SyncItem, want map[Tag]SyncAction) {
+	t.Helper()
+	got := syncActions(items)
+	if len(got) != len(want) {
+		t.Errorf("plan %v, want %v", got, want)
+		return
+	}
+	for tag, action := range want {
+		if got[tag] != action {
+			t.Errorf("%s: action '%s', want '%s'", tag, got[tag], action)
+		}
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newTestRegistry(t), newTestRegistry(t)
+	same, changed, missing := Tag{"app", "1"}, Tag{"app", "2"}, Tag{"lib", "1"}
+	pushTestImage(t, src, same, "1", "a")
+	pushTestImage(t, src, changed, "2", "b")
+	pushTestImage(t, src, missing, "3", "c")
+	pushTestImage(t, dst, same, "1", "a")
+	pushTestImage(t, dst, changed, "old", "x")
+
+	items, err := NewSync(src, dst, Options{}, Options{}).PlanSync(ctx, SyncOptions{MaxEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyncActions(t, items, map[Tag]SyncAction{
+		same:    SyncActionUpToDate,
+		changed: SyncActionUpdate,
+		missing: SyncActionCopy,
+	})
+}
+
+func TestApplySyncResumes(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newTestRegistry(t), newTestRegistry(t)
+	first, second := Tag{"app", "1"}, Tag{"app", "2"}
+	want := map[Tag]digest.Digest{
+		first:  pushTestImage(t, src, first, "1", "shared", "a"),
+		second: pushTestImage(t, src, second, "2", "shared", "b"),
+	}
+	uc := NewSync(src, dst, Options{}, Options{})
+	opts := SyncOptions{MaxEntries: 100}
+
+	// the first run is interrupted after the first tag and a layer of the second one
+	items, err := uc.PlanSync(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := []SyncItem{}
+	for _, v := range items {
+		if v.Tag == first {
+			partial = append(partial, v)
+		}
+	}
+	if _, err := uc.ApplySync(ctx, partial, opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := dst.GetRepo(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTestBlob(t, r, schema2.MediaTypeLayer, []byte("b"))
+
+	items, err = uc.PlanSync(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyncActions(t, items, map[Tag]SyncAction{first: SyncActionUpToDate, second: SyncActionCopy})
+	res, err := uc.ApplySync(ctx, items, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range res {
+		if v.Status != SyncStatusDone {
+			t.Errorf("%s: status '%s', want done", v.Tag, v.Status)
+		}
+		// only the config of the second image is missing
+		if v.Tag == second && (v.Existing != 2 || v.Uploaded != 1) {
+			t.Errorf("%s: %d blobs existing and %d uploaded, want 2 and 1", v.Tag, v.Existing, v.Uploaded)
+		}
+	}
+	for ref, dgst := range want {
+		checkDigest(t, dst, ref, dgst)
+	}
+
+	items, err = uc.PlanSync(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyncActions(t, items, map[Tag]SyncAction{first: SyncActionUpToDate, second: SyncActionUpToDate})
+}
+
+func TestSyncDeleteExtraneousKeepsSiblings(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newTestRegistry(t), newTestRegistry(t)
+	kept, sibling, extraneous := Tag{"app", "1"}, Tag{"app", "latest"}, Tag{"app", "old"}
+	dgst := pushTestImage(t, src, kept, "1", "a")
+	pushTestImage(t, dst, kept, "1", "a")
+	pushTestImage(t, dst, sibling, "1", "a")
+	pushTestImage(t, dst, extraneous, "old", "x")
+
+	uc := NewSync(src, dst, Options{}, Options{})
+	opts := SyncOptions{MaxEntries: 100, DeleteExtraneous: true, ContinueOnError: true}
+	items, err := uc.PlanSync(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyncActions(t, items, map[Tag]SyncAction{
+		kept:       SyncActionUpToDate,
+		sibling:    SyncActionDelete,
+		extraneous: SyncActionDelete,
+	})
+	res, err := uc.ApplySync(ctx, items, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[Tag]SyncStatus{}
+	for _, v := range res {
+		status[v.Tag] = v.Status
+	}
+	// the registry deletes manifests only, so the sibling can't go without the kept tag
+	if status[sibling] != SyncStatusFailed || status[extraneous] != SyncStatusDone {
+		t.Errorf("statuses %v, want the sibling failed and the extraneous tag done", status)
+	}
+	checkDigest(t, dst, kept, dgst)
+	checkDigest(t, dst, sibling, dgst)
+	if _, err := dst.GetV2Descriptor(ctx, extraneous.Repo, extraneous.Name); !errors.Is(err, docker.ErrManifestUnknown) {
+		t.Errorf("%s: %v, want %v", extraneous, err, docker.ErrManifestUnknown)
+	}
+}
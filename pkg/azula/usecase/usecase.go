@@ -2,81 +2,132 @@ package usecase
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"io"
 
 	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
-
-	"github.com/docker/distribution"
 )
 
 type usecase struct {
 	Registry docker.Manager
+	// limit is shared by all the calls of the usecase
+	limit limiter
+}
+
+type Options struct {
+	// Concurrency limits registry calls made at once by the usecase, DefaultConcurrency if zero.
+	Concurrency int
+}
+
+type ListOptions struct {
+	// Describe resolves descriptors and platforms, it costs extra requests per tag.
+	Describe bool
+	// Platform keeps only images having it, implies Describe.
+	Platform string
 }
 
 type ManUsecase interface {
-	ListReposLike(context.Context, string, int) ([]string, error)
-	GetImagesWithTags(context.Context, []string) ([]string, error)
-	DeleteImageByTag(context.Context, []string) error
+	ListReposLike(context.Context, string, int) ([]Repository, error)
+	GetImagesWithTags(context.Context, []Repository) ([]Tag, error)
+	ListImages(context.Context, []Repository, ListOptions) ([]Image, error)
+	DeleteImageByTag(context.Context, []Tag, DeleteOptions) ([]DeleteResult, error)
+	PlanDelete(context.Context, []Tag, DeleteOptions) ([]DeletePlan, []DeleteResult, error)
+	ApplyDeletePlan(context.Context, []DeletePlan, DeleteOptions) ([]DeleteResult, error)
+	EstimateReclaimable(context.Context, []DeletePlan, DeleteOptions) (int64, error)
+	Inspect(context.Context, Tag, string) (ImageDetails, error)
+	PlanPrune(context.Context, []Repository, PruneRules) ([]PruneCandidate, error)
+	Copy(context.Context, Tag, Tag, CopyOptions) (CopyResult, error)
+	PlanMove(context.Context, MoveRule, int) ([]MoveItem, error)
+	ApplyMove(context.Context, []MoveItem, MoveOptions) ([]MoveResult, error)
+	Export(context.Context, []Tag, io.Writer, ExportOptions) (ExportResult, error)
+	Import(context.Context, io.ReaderAt, int64, ImportOptions) ([]ImportResult, error)
 }
 
-func New(reg docker.Manager) ManUsecase {
+func New(reg docker.Manager, opts Options) ManUsecase {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
 	return &usecase{
 		Registry: reg,
+		limit:    newLimiter(opts.Concurrency),
 	}
 }
 
-func (u *usecase) ListReposLike(ctx context.Context, like string, max_entries int) ([]string, error) {
-	return u.Registry.ListReposLike(ctx, like, max_entries)
+func (u *usecase) ListReposLike(ctx context.Context, like string, max_entries int) ([]Repository, error) {
+	names, err := u.Registry.ListReposLike(ctx, like, max_entries)
+	if err != nil {
+		return []Repository{}, err
+	}
+	res := make([]Repository, 0, len(names))
+	for _, v := range names {
+		res = append(res, Repository{Name: v})
+	}
+	return res, nil
 }
 
-func (u *usecase) GetImagesWithTags(ctx context.Context, repos []string) ([]string, error) {
-	res := make([]string, 0, 4)
-	for _, repo := range repos {
-		r, err := u.Registry.GetRepo(ctx, repo)
-		if err != nil {
-			return []string{}, err
-		}
-		tags, err := r.Tags(ctx).All(ctx)
-		if err != nil {
-			return []string{}, err
+func (u *usecase) GetImagesWithTags(ctx context.Context, repos []Repository) ([]Tag, error) {
+	tags, err := u.repoTags(ctx, repos)
+	if err != nil {
+		return []Tag{}, err
+	}
+	res := make([]Tag, 0, 4)
+	for i, repo := range repos {
+		for _, tag := range tags[i] {
+			res = append(res, Tag{Repo: repo.Name, Name: tag})
 		}
-		joinRepoWithTag(repo, tags)
-		res = append(res, tags...)
 	}
 	return res, nil
 }
 
-func (u *usecase) DeleteImageByTag(ctx context.Context, repoTags []string) error {
-	for _, v := range repoTags {
-		rt := strings.Split(v, ":")
-		repo := rt[0]
-		tag := rt[1]
-		if len(repo) < 1 || len(tag) < 1 {
-			return fmt.Errorf("repo or tag empty. repo: '%s', tag: '%s'", repo, tag)
-		}
-		r, err := u.Registry.GetRepo(ctx, rt[0])
-		if err != nil {
-			return err
+func (u *usecase) ListImages(ctx context.Context, repos []Repository, opts ListOptions) ([]Image, error) {
+	filter, err := parsePlatformFilter(opts.Platform)
+	if err != nil {
+		return []Image{}, err
+	}
+	describe := opts.Describe || filter != nil
+	tags, err := u.repoTags(ctx, repos)
+	if err != nil {
+		return []Image{}, err
+	}
+	images := make([]Image, 0, 4)
+	for i, repo := range repos {
+		for _, tag := range tags[i] {
+			images = append(images, Image{Tag: Tag{Repo: repo.Name, Name: tag}})
 		}
-		m, err := r.Manifests(ctx, distribution.WithTag(tag))
+	}
+	if !describe {
+		return images, nil
+	}
+
+	keep := make([]bool, len(images))
+	err = parallel(ctx, u.limit, len(images), func(ctx context.Context, i int) error {
+		img := &images[i]
+		desc, err := u.Registry.GetV2Descriptor(ctx, img.Repo, img.Name)
 		if err != nil {
 			return err
 		}
-		desc, err := u.Registry.GetV2Descriptor(ctx, repo, tag)
+		platforms, err := u.getPlatforms(ctx, img.Repo, desc)
 		if err != nil {
 			return err
 		}
-		err = m.Delete(ctx, desc.Digest)
-		if err != nil {
-			return err
+		keep[i] = filter == nil || hasPlatform(platforms, filter)
+		img.Digest = desc.Digest
+		img.Size = desc.Size
+		img.MediaType = desc.MediaType
+		img.Kind = docker.ManifestKind(desc.MediaType)
+		img.Platforms = platforms
+		if len(platforms) == 1 && desc.Digest == platforms[0].Digest {
+			img.Created = createdTime(platforms[0].created)
 		}
+		return nil
+	})
+	if err != nil {
+		return []Image{}, err
 	}
-	return nil
-}
-
-func joinRepoWithTag(repo string, tags []string) {
-	for i, t := range tags {
-		tags[i] = repo + ":" + t
+	res := images[:0]
+	for i, img := range images {
+		if keep[i] {
+			res = append(res, img)
+		}
 	}
+	return res, nil
 }
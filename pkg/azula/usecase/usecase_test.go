@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nikgalkin/azula/pkg/azula/repository/docker"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/handlers"
+	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRegistry starts an in-process registry with deletes enabled.
+func newTestRegistry(t *testing.T) docker.Manager {
+	t.Helper()
+	return newTestManager(t, newTestRegistryApp())
+}
+
+// newTestRegistryApp is the handler of an in-process registry with deletes enabled,
+// tests wrap it to break requests.
+func newTestRegistryApp() http.Handler {
+	config := &configuration.Configuration{}
+	config.Storage = configuration.Storage{
+		"inmemory": configuration.Parameters{},
+		"delete":   configuration.Parameters{"enabled": true},
+	}
+	config.HTTP.Secret = "secret"
+	config.Log.AccessLog.Disabled = true
+	logrus.SetLevel(logrus.FatalLevel)
+	return handlers.NewApp(context.Background(), config)
+}
+
+func newTestManager(t *testing.T, h http.Handler) docker.Manager {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	ri := docker.RegistryInit{URL: srv.URL}
+	reg, err := ri.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// pushTestImage pushes an image of the layers, images of the same layers and
+// config get the same digest in every registry.
+func pushTestImage(t *testing.T, reg docker.Manager, ref Tag, config string, layers ...string) digest.Digest {
+	t.Helper()
+	return pushTestImageConfig(t, reg, ref, testImageConfig(config), layers...)
+}
+
+// testImageConfig is a config without a created date, config is kept in its labels.
+func testImageConfig(config string) map[string]interface{} {
+	return map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"config":       map[string]interface{}{"Labels": map[string]string{"config": config}},
+		"rootfs":       map[string]interface{}{"type": "layers"},
+	}
+}
+
+func pushTestImageConfig(t *testing.T, reg docker.Manager, ref Tag, config map[string]interface{}, layers ...string) digest.Digest {
+	t.Helper()
+	ctx := context.Background()
+	r, err := reg.GetRepo(ctx, ref.Repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := schema2.Manifest{Versioned: schema2.SchemaVersion}
+	m.Config = pushTestBlob(t, r, schema2.MediaTypeImageConfig, cfg)
+	for _, l := range layers {
+		m.Layers = append(m.Layers, pushTestBlob(t, r, schema2.MediaTypeLayer, []byte(l)))
+	}
+	dm, err := schema2.FromStruct(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := r.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, dm, distribution.WithTag(ref.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dgst
+}
+
+func pushTestBlob(t *testing.T, r distribution.Repository, mediaType string, data []byte) distribution.Descriptor {
+	t.Helper()
+	desc, err := r.Blobs(context.Background()).Put(context.Background(), mediaType, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc.MediaType = mediaType
+	return desc
+}
+
+func checkDigest(t *testing.T, reg docker.Manager, ref Tag, want digest.Digest) {
+	t.Helper()
+	desc, err := reg.GetV2Descriptor(context.Background(), ref.Repo, ref.Name)
+	if err != nil {
+		t.Errorf("%s: %v", ref, err)
+		return
+	}
+	if desc.Digest != want {
+		t.Errorf("%s points at %s, want %s", ref, desc.Digest, want)
+	}
+}